@@ -5,27 +5,49 @@ import (
 	"strings"
 )
 
-
+// Backend описывает бэкенд с его весом для балансировки
+type Backend struct {
+	URL    *url.URL
+	Weight int
+}
 
 type Backends struct {
-    envURLs string
+	envURLs string
+	list    []BackendConfig
 }
 
-func NewBackends(envURLs string) *Backends {
-    return &Backends{envURLs: envURLs}
+func NewBackends(envURLs string, list []BackendConfig) *Backends {
+	return &Backends{envURLs: envURLs, list: list}
 }
 
-func (r *Backends) GetBackends() ([]*url.URL, error) {
-    rawUrls := strings.Split(r.envURLs, ",")
-    var urls []*url.URL
-    
-    for _, u := range rawUrls {
-        parsed, err := url.Parse(strings.TrimSpace(u))
-        if err != nil {
-            return nil, err
-        }
-        urls = append(urls, parsed)
-    }
-    
-    return urls, nil
-}
\ No newline at end of file
+// GetBackends возвращает бэкенды из списка backends, а если он пуст -
+// из строки с URL через запятую, в этом случае у всех бэкендов вес 1
+func (r *Backends) GetBackends() ([]Backend, error) {
+	var backends []Backend
+
+	if len(r.list) > 0 {
+		for _, b := range r.list {
+			parsed, err := url.Parse(strings.TrimSpace(b.URL))
+			if err != nil {
+				return nil, err
+			}
+			weight := b.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			backends = append(backends, Backend{URL: parsed, Weight: weight})
+		}
+		return backends, nil
+	}
+
+	rawUrls := strings.Split(r.envURLs, ",")
+	for _, u := range rawUrls {
+		parsed, err := url.Parse(strings.TrimSpace(u))
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, Backend{URL: parsed, Weight: 1})
+	}
+
+	return backends, nil
+}
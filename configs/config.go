@@ -3,6 +3,7 @@ package configs
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -23,10 +24,236 @@ type RateLimiterConfig struct {
 	} `mapstructure:"special_clients"`
 }
 
+type BackendConfig struct {
+	URL    string `mapstructure:"url"`
+	Weight int    `mapstructure:"weight"`
+}
+
+type BalancerConfig struct {
+	Strategy     string  `mapstructure:"strategy"`
+	EWMAAlpha    float64 `mapstructure:"ewma_alpha"`
+	VirtualNodes int     `mapstructure:"virtual_nodes"`
+}
+
+type HealthCheckConfig struct {
+	Enabled            bool          `mapstructure:"enabled"`
+	Path               string        `mapstructure:"path"`
+	Interval           time.Duration `mapstructure:"interval"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	HealthyThreshold   int           `mapstructure:"healthy_threshold"`
+	UnhealthyThreshold int           `mapstructure:"unhealthy_threshold"`
+}
+
+type OutlierDetectionConfig struct {
+	Enabled            bool          `mapstructure:"enabled"`
+	ConsecutiveErrors  int           `mapstructure:"consecutive_errors"`
+	BaseEjectionTime   time.Duration `mapstructure:"base_ejection_time"`
+	MaxEjectionTime    time.Duration `mapstructure:"max_ejection_time"`
+	MaxEjectionPercent int           `mapstructure:"max_ejection_percent"`
+}
+
+type CircuitBreakerConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	Window           time.Duration `mapstructure:"window"`
+	ErrorThreshold   float64       `mapstructure:"error_threshold"`
+	MinRequests      int           `mapstructure:"min_requests"`
+	OpenDuration     time.Duration `mapstructure:"open_duration"`
+	HalfOpenRequests int           `mapstructure:"half_open_requests"`
+}
+
+type SlowStartConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	Window           time.Duration `mapstructure:"window"`
+	MinWeightPercent int           `mapstructure:"min_weight_percent"`
+	Aggression       float64       `mapstructure:"aggression"`
+}
+
+// ClientIPConfig описывает доверенные прокси, заголовкам которых можно верить при определении IP клиента
+type ClientIPConfig struct {
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	Source         string   `mapstructure:"source"`
+	TrustedHeader  string   `mapstructure:"trusted_header"`
+	LegacyHeaders  bool     `mapstructure:"legacy_headers"`
+}
+
+type StickySessionConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	CookieName string        `mapstructure:"cookie_name"`
+	TTL        time.Duration `mapstructure:"ttl"`
+	Secret     string        `mapstructure:"secret"`
+}
+
+type RetryConfig struct {
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	Methods     []string      `mapstructure:"methods"`
+	StatusCodes []int         `mapstructure:"status_codes"`
+	Errors      []string      `mapstructure:"errors"`
+	BackoffBase time.Duration `mapstructure:"backoff_base"`
+	BackoffMax  time.Duration `mapstructure:"backoff_max"`
+}
+
+// RetryBudgetConfig ограничивает долю повторов среди всех запросов прокси
+type RetryBudgetConfig struct {
+	Enabled             bool          `mapstructure:"enabled"`
+	Ratio               float64       `mapstructure:"ratio"`
+	MinRetriesPerSecond int           `mapstructure:"min_retries_per_second"`
+	Window              time.Duration `mapstructure:"window"`
+}
+
+// RequestBodyConfig ограничивает размер тела запроса и его буферизацию для повторов
+type RequestBodyConfig struct {
+	MaxSize          int64  `mapstructure:"max_size"`
+	ReplayBufferSize int64  `mapstructure:"replay_buffer_size"`
+	SpillToDisk      bool   `mapstructure:"spill_to_disk"`
+	SpillDir         string `mapstructure:"spill_dir"`
+}
+
+// MirrorConfig описывает копирование части запросов в теневой пул
+type MirrorConfig struct {
+	Pool    string        `mapstructure:"pool"`
+	Percent float64       `mapstructure:"percent"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// CanaryConfig описывает отправку части запросов в канареечный пул
+type CanaryConfig struct {
+	Pool        string  `mapstructure:"pool"`
+	Percent     float64 `mapstructure:"percent"`
+	Header      string  `mapstructure:"header"`
+	HeaderValue string  `mapstructure:"header_value"`
+	Cookie      string  `mapstructure:"cookie"`
+	CookieValue string  `mapstructure:"cookie_value"`
+	Consistent  bool    `mapstructure:"consistent"`
+}
+
+// UpgradeConfig ограничивает WebSocket и другие соединения с переключением протокола
+type UpgradeConfig struct {
+	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	MaxLifetime  time.Duration `mapstructure:"max_lifetime"`
+	MaxPerClient int           `mapstructure:"max_per_client"`
+}
+
+// AdminConfig описывает отдельный порт API управления прокси
+type AdminConfig struct {
+	Address string `mapstructure:"address"` // по умолчанию API доступно только с локального адреса
+	Token   string `mapstructure:"token"`   // если задан, запросы к API должны передавать его как Bearer-токен
+}
+
+// ListenerConfig описывает протоколы, которые принимает прокси
+type ListenerConfig struct {
+	H2C           bool                `mapstructure:"h2c"`
+	TLS           TLSConfig           `mapstructure:"tls"`
+	ProxyProtocol ProxyProtocolConfig `mapstructure:"proxy_protocol"`
+}
+
+// ProxyProtocolConfig описывает прием заголовков PROXY protocol v1 и v2 от TCP-балансировщика
+type ProxyProtocolConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	TrustedSources []string      `mapstructure:"trusted_sources"`
+	HeaderTimeout  time.Duration `mapstructure:"header_timeout"`
+}
+
+// TLSConfig описывает дополнительный порт с терминированием TLS
+type TLSConfig struct {
+	Enabled      bool                `mapstructure:"enabled"`
+	Port         string              `mapstructure:"port"`
+	MinVersion   string              `mapstructure:"min_version"`
+	CipherSuites []string            `mapstructure:"cipher_suites"`
+	Certificates []CertificateConfig `mapstructure:"certificates"`
+	Reload       bool                `mapstructure:"reload"`
+	ClientAuth   ClientAuthConfig    `mapstructure:"client_auth"`
+}
+
+// ClientAuthConfig описывает проверку клиентских сертификатов на TLS-порту
+type ClientAuthConfig struct {
+	Mode     string   `mapstructure:"mode"`
+	CAFile   string   `mapstructure:"ca_file"`
+	Identity []string `mapstructure:"identity"`
+}
+
+// CertificateConfig описывает пару файлов сертификата и ключа, сертификат выбирается по SNI
+type CertificateConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// UpstreamTLSConfig описывает TLS-соединения с бэкендами пула
+type UpstreamTLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// PoolConfig описывает именованный пул бэкендов со своей стратегией балансировки
+type PoolConfig struct {
+	Name     string            `mapstructure:"name"`
+	Backends []BackendConfig   `mapstructure:"backends"`
+	Balancer BalancerConfig    `mapstructure:"balancer"`
+	Timeout  time.Duration     `mapstructure:"timeout"`
+	Protocol string            `mapstructure:"protocol"`
+	TLS      UpstreamTLSConfig `mapstructure:"upstream_tls"`
+	Retry    RetryConfig       `mapstructure:"retry"`
+	Mirror   MirrorConfig      `mapstructure:"mirror"`
+	Canary   CanaryConfig      `mapstructure:"canary"`
+}
+
+// RouteConfig описывает правило, по которому запрос направляется в пул бэкендов
+type RouteConfig struct {
+	Name       string            `mapstructure:"name"`
+	Host       string            `mapstructure:"host"`
+	PathPrefix string            `mapstructure:"path_prefix"`
+	PathRegex  string            `mapstructure:"path_regex"`
+	Methods    []string          `mapstructure:"methods"`
+	Headers    map[string]string `mapstructure:"headers"`
+	Pool       string            `mapstructure:"pool"`
+	Hedge      HedgeConfig       `mapstructure:"hedge"`
+	Streaming  StreamingConfig   `mapstructure:"streaming"`
+}
+
+// StreamingConfig описывает маршрут с потоковыми ответами (SSE, long-poll)
+type StreamingConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	MaxDuration   time.Duration `mapstructure:"max_duration"`
+	HeaderTimeout time.Duration `mapstructure:"header_timeout"`
+}
+
+// HedgeConfig описывает дублирование GET-запросов маршрута на другой бэкенд
+type HedgeConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Percentile float64       `mapstructure:"percentile"`
+	Delay      time.Duration `mapstructure:"delay"`
+	MinDelay   time.Duration `mapstructure:"min_delay"`
+	MaxDelay   time.Duration `mapstructure:"max_delay"`
+}
+
 type Config struct {
-	ProxyPort   string
-	BackendURLs string
-	RateLimiter RateLimiterConfig
+	ProxyPort        string
+	Listener         ListenerConfig
+	Admin            AdminConfig
+	BackendURLs      string
+	Backends         []BackendConfig
+	Balancer         BalancerConfig
+	Timeout          time.Duration
+	Protocol         string
+	UpstreamTLS      UpstreamTLSConfig
+	Retry            RetryConfig
+	RetryBudget      RetryBudgetConfig
+	RequestBody      RequestBodyConfig
+	Mirror           MirrorConfig
+	Canary           CanaryConfig
+	Upgrade          UpgradeConfig
+	Pools            []PoolConfig
+	Routes           []RouteConfig
+	HealthCheck      HealthCheckConfig
+	OutlierDetection OutlierDetectionConfig
+	CircuitBreaker   CircuitBreakerConfig
+	SlowStart        SlowStartConfig
+	StickySession    StickySessionConfig
+	RateLimiter      RateLimiterConfig
+	ClientIP         ClientIPConfig
 }
 
 func Load() *Config {
@@ -44,8 +271,13 @@ func Load() *Config {
 		}
 	}
 
-	cfg.BackendURLs = viper.Get("backend_urls").(string)
-	if cfg.BackendURLs == "" {
+	if err := viper.UnmarshalKey("backends", &cfg.Backends); err != nil {
+		log.Fatal("failed to load backends config: ", err)
+	}
+
+	// список backends имеет приоритет, backend_urls оставлен для обратной совместимости
+	cfg.BackendURLs = viper.GetString("backend_urls")
+	if len(cfg.Backends) == 0 && cfg.BackendURLs == "" {
 		if envBackends := os.Getenv("BACKEND_URLS"); envBackends != "" {
 			cfg.BackendURLs = envBackends
 		} else {
@@ -53,10 +285,106 @@ func Load() *Config {
 		}
 	}
 
+	if err := viper.UnmarshalKey("balancer", &cfg.Balancer); err != nil {
+		log.Fatal("failed to load balancer config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("listener", &cfg.Listener); err != nil {
+		log.Fatal("failed to load listener config: ", err)
+	}
+	if cfg.Listener.TLS.Enabled && (cfg.Listener.TLS.Port == "" || len(cfg.Listener.TLS.Certificates) == 0) {
+		log.Fatal("tls listener requires port and certificates")
+	}
+	if mode := cfg.Listener.TLS.ClientAuth.Mode; mode != "" && mode != "none" && cfg.Listener.TLS.ClientAuth.CAFile == "" {
+		log.Fatal("tls client auth requires ca_file")
+	}
+
+	if err := viper.UnmarshalKey("admin", &cfg.Admin); err != nil {
+		log.Fatal("failed to load admin config: ", err)
+	}
+	if cfg.Admin.Address == "" {
+		cfg.Admin.Address = "127.0.0.1:8081"
+	}
+	if cfg.Admin.Token == "" {
+		cfg.Admin.Token = os.Getenv("ADMIN_TOKEN")
+	}
+
+	cfg.Timeout = viper.GetDuration("timeout")
+	cfg.Protocol = viper.GetString("protocol")
+
+	if err := viper.UnmarshalKey("upstream_tls", &cfg.UpstreamTLS); err != nil {
+		log.Fatal("failed to load upstream tls config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("retry", &cfg.Retry); err != nil {
+		log.Fatal("failed to load retry config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("retry_budget", &cfg.RetryBudget); err != nil {
+		log.Fatal("failed to load retry budget config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("request_body", &cfg.RequestBody); err != nil {
+		log.Fatal("failed to load request body config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("mirror", &cfg.Mirror); err != nil {
+		log.Fatal("failed to load mirror config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("canary", &cfg.Canary); err != nil {
+		log.Fatal("failed to load canary config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("upgrade", &cfg.Upgrade); err != nil {
+		log.Fatal("failed to load upgrade config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("pools", &cfg.Pools); err != nil {
+		log.Fatal("failed to load pools config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("routes", &cfg.Routes); err != nil {
+		log.Fatal("failed to load routes config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("health_check", &cfg.HealthCheck); err != nil {
+		log.Fatal("failed to load health check config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("outlier_detection", &cfg.OutlierDetection); err != nil {
+		log.Fatal("failed to load outlier detection config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("circuit_breaker", &cfg.CircuitBreaker); err != nil {
+		log.Fatal("failed to load circuit breaker config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("slow_start", &cfg.SlowStart); err != nil {
+		log.Fatal("failed to load slow start config: ", err)
+	}
+
+	if err := viper.UnmarshalKey("sticky_session", &cfg.StickySession); err != nil {
+		log.Fatal("failed to load sticky session config: ", err)
+	}
+	if cfg.StickySession.Secret == "" {
+		cfg.StickySession.Secret = os.Getenv("STICKY_SESSION_SECRET")
+	}
+	if cfg.StickySession.Enabled && cfg.StickySession.Secret == "" {
+		log.Fatal("empty sticky session secret")
+	}
+
 	if err := viper.UnmarshalKey("rate_limiter", &cfg.RateLimiter); err != nil {
 		log.Fatal("failed to load rate limiter config: ", err)
 	}
 
+	if err := viper.UnmarshalKey("client_ip", &cfg.ClientIP); err != nil {
+		log.Fatal("failed to load client ip config: ", err)
+	}
+	if cfg.ClientIP.Source == "proxy_protocol" && !cfg.Listener.ProxyProtocol.Enabled {
+		log.Fatal("client ip source proxy_protocol requires listener.proxy_protocol")
+	}
+
 	return cfg
 }
 
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/BabyJhon/cloudru-bootcamp/configs"
+	"github.com/BabyJhon/cloudru-bootcamp/internal/handler"
+	"github.com/BabyJhon/cloudru-bootcamp/internal/middleware"
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+	"github.com/gorilla/mux"
+)
+
+// newAdminServer создает сервер API управления. Он слушает отдельный адрес,
+// чтобы клиенты прокси не могли менять бэкенды, лимиты и разделение трафика
+func newAdminServer(cfg configs.AdminConfig, services *service.Service) *http.Server {
+	router := mux.NewRouter()
+	router.Use(middleware.AdminAuth(cfg.Token))
+
+	// API для управления лимитами
+	rateLimitHandler := handler.NewRateLimitHandler(services.ClientService)
+	rateLimitHandler.RegisterRoutes(router)
+
+	// API для управления бэкендами и просмотра их состояния
+	backendHandler := handler.NewBackendHandler(services.Pools, services.BackendService)
+	backendHandler.RegisterRoutes(router)
+
+	// API для просмотра бюджета повторов
+	retryBudgetHandler := handler.NewRetryBudgetHandler(services.RetryBudget)
+	retryBudgetHandler.RegisterRoutes(router)
+
+	return &http.Server{
+		Addr:    cfg.Address,
+		Handler: router,
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BabyJhon/cloudru-bootcamp/configs"
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+	"github.com/gorilla/mux"
+)
+
+func TestAdminServer_SeparateFromProxy(t *testing.T) {
+	services := newTestServices(t, []string{service.DefaultPool}, nil, nil)
+	services.BackendService = service.NewBackendService(services.Pools)
+
+	router := mux.NewRouter()
+	registerProxyRoutes(router, services)
+	admin := newAdminServer(configs.AdminConfig{Address: "127.0.0.1:0", Token: "secret"}, services)
+
+	// на публичном порту API управления нет, запрос уходит в пул
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/backends", nil))
+	if got := w.Body.String(); got != service.DefaultPool {
+		t.Errorf("Expected request to be proxied, got %q", got)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"valid token", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/backends", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			admin.Handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("Expected status code %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,7 +11,6 @@ import (
 	"time"
 
 	"github.com/BabyJhon/cloudru-bootcamp/configs"
-	"github.com/BabyJhon/cloudru-bootcamp/internal/handler"
 	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
 	"github.com/gorilla/mux"
 )
@@ -18,32 +18,25 @@ import (
 func Run() {
 	cfg := configs.Load()
 
-	backends := configs.NewBackends(cfg.BackendURLs)
-	backendURLs, err := backends.GetBackends()
+	backends, err := configs.NewBackends(cfg.BackendURLs, cfg.Backends).GetBackends()
 	if err != nil {
 		log.Fatal("Error loading backends:", err)
 	}
 
 	// инициализация всех сервисов
-	services := service.NewService(backendURLs)
+	services := service.NewService(backends)
+
+	// запускаем активную проверку бэкендов всех пулов
+	for _, pool := range services.Pools {
+		pool.Start()
+	}
 
 	// Создаём роутер
 	router := mux.NewRouter()
 
-	// API для управления лимитами
-	rateLimitHandler := handler.NewRateLimitHandler(services.ClientService)
-	rateLimitHandler.RegisterRoutes(router)
-
-	// Прокси-обработчик
-	proxyHandler := handler.NewProxyHandler(
-		services.Balancer,
-		services.RateLimiter,
-		services.ClientIdentifier,
-		10, // concurrentLimit
-	)
-
-	// Все остальные запросы идут через прокси
-	router.PathPrefix("/").Handler(proxyHandler)
+	// Все запросы идут через прокси в пулы согласно маршрутам, API управления на отдельном порту
+	registerProxyRoutes(router, services)
+	adminSrv := newAdminServer(cfg.Admin, services)
 
 	// Создаем HTTP сервер
 	srv := &http.Server{
@@ -51,6 +44,43 @@ func Run() {
 		Handler: router,
 	}
 
+	// HTTP/2 без TLS принимается только от клиентов, заранее знающих о его поддержке
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(cfg.Listener.H2C)
+	srv.Protocols = protocols
+
+	// HTTPS-порт с выбором сертификата по SNI
+	var tlsSrv *http.Server
+	if services.Certificates != nil {
+		tlsSrv, err = newTLSServer(cfg.Listener.TLS, router, services.Certificates)
+		if err != nil {
+			log.Fatal("Error configuring tls listener: ", err)
+		}
+		if cfg.Listener.TLS.Reload {
+			if err := services.Certificates.Start(); err != nil {
+				log.Fatal("Error watching tls certificates: ", err)
+			}
+		}
+	}
+
+	// порты открываются заранее, чтобы ошибка конфигурации PROXY protocol остановила запуск
+	ln, err := listen(srv.Addr, cfg.Listener.ProxyProtocol)
+	if err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+	var tlsLn net.Listener
+	if tlsSrv != nil {
+		tlsLn, err = listen(tlsSrv.Addr, cfg.Listener.ProxyProtocol)
+		if err != nil {
+			log.Fatalf("Error starting tls server: %v", err)
+		}
+	}
+	adminLn, err := net.Listen("tcp", adminSrv.Addr)
+	if err != nil {
+		log.Fatalf("Error starting admin server: %v", err)
+	}
+
 	// Канал для получения сигналов завершения
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
@@ -58,11 +88,27 @@ func Run() {
 	// Запускаем сервер в горутине
 	go func() {
 		log.Printf("Starting proxy server on :%s", cfg.ProxyPort)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Error starting server: %v", err)
 		}
 	}()
 
+	if tlsSrv != nil {
+		go func() {
+			log.Printf("Starting tls proxy server on :%s", cfg.Listener.TLS.Port)
+			if err := tlsSrv.ServeTLS(tlsLn, "", ""); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Error starting tls server: %v", err)
+			}
+		}()
+	}
+
+	go func() {
+		log.Printf("Starting admin server on %s", adminSrv.Addr)
+		if err := adminSrv.Serve(adminLn); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error starting admin server: %v", err)
+		}
+	}()
+
 	// Ждем сигнал завершения
 	<-stop
 	log.Println("Shutting down server...")
@@ -75,8 +121,20 @@ func Run() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("Error during server shutdown: %v", err)
 	}
+	if tlsSrv != nil {
+		if err := tlsSrv.Shutdown(ctx); err != nil {
+			log.Printf("Error during tls server shutdown: %v", err)
+		}
+		services.Certificates.Stop()
+	}
+	if err := adminSrv.Shutdown(ctx); err != nil {
+		log.Printf("Error during admin server shutdown: %v", err)
+	}
 
 	// Останавливаем все сервисы
+	for _, pool := range services.Pools {
+		pool.Stop()
+	}
 	services.RateLimiter.Stop()
 	log.Println("Server stopped gracefully")
 }
\ No newline at end of file
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"net"
+
+	"github.com/BabyJhon/cloudru-bootcamp/configs"
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// listen открывает TCP-порт и при необходимости принимает на нем PROXY protocol,
+// тогда r.RemoteAddr содержит адрес клиента, а не балансировщика
+func listen(addr string, cfg configs.ProxyProtocolConfig) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return ln, nil
+	}
+
+	proxyLn, err := service.NewProxyProtocolListener(ln, service.ProxyProtocolConfig{
+		TrustedSources: cfg.TrustedSources,
+		HeaderTimeout:  cfg.HeaderTimeout,
+	})
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return proxyLn, nil
+}
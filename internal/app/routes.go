@@ -0,0 +1,121 @@
+package app
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/handler"
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+	"github.com/gorilla/mux"
+)
+
+// concurrentLimit - общее ограничение одновременных запросов на все маршруты и пулы
+const concurrentLimit = 10
+
+// newProxyHandler создает прокси-обработчик для пула бэкендов
+func newProxyHandler(pool *service.Pool, services *service.Service, limiter chan struct{}) *handler.ProxyHandler {
+	proxyHandler := handler.NewProxyHandler(
+		pool.Balancer,
+		services.RateLimiter,
+		services.ClientIdentifier,
+		concurrentLimit,
+	)
+	proxyHandler.SetConcurrencyLimiter(limiter)
+	proxyHandler.SetTimeout(pool.Timeout)
+	proxyHandler.SetUpstreamProtocol(pool.Protocol)
+	if pool.TLSConfig != nil {
+		proxyHandler.SetUpstreamTLS(pool.TLSConfig)
+	}
+	proxyHandler.SetRetryPolicy(pool.RetryPolicy)
+	proxyHandler.UseRetryBudget(services.RetryBudget)
+	proxyHandler.SetRequestBodyLimits(services.RequestBody)
+	proxyHandler.UseUpgradeTracker(services.UpgradeTracker)
+	proxyHandler.AddObserver(pool.OutlierDetector)
+	proxyHandler.UseCircuitBreakers(pool.CircuitBreakers)
+	proxyHandler.UseStickySessions(services.StickySessions, pool.Name)
+	if pool.Mirror != nil {
+		proxyHandler.UseMirror(pool.Mirror)
+	}
+
+	return proxyHandler
+}
+
+// applyRouteOptions включает настройки маршрута в обработчике
+func applyRouteOptions(proxyHandler *handler.ProxyHandler, route *service.Route) {
+	if route.Streaming.Enabled {
+		proxyHandler.UseStreaming(route.Streaming)
+	}
+	if route.Hedge != nil {
+		proxyHandler.UseHedging(route.Hedge)
+	}
+}
+
+// newCanaryTargets возвращает обработчики пулов, в которые уходят запросы канареечного разделения.
+// Обработчик создается при первом запросе в пул: канареечный пул может смениться через API,
+// а заранее создавать обработчики для всех пулов незачем. Для маршрута они получают
+// его настройки, чтобы канареечный трафик обрабатывался так же
+func newCanaryTargets(services *service.Service, route *service.Route, limiter chan struct{}) handler.CanaryTargets {
+	var mu sync.Mutex
+	targets := make(map[string]http.Handler)
+
+	return func(name string) http.Handler {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if target, ok := targets[name]; ok {
+			return target
+		}
+		pool, ok := services.Pool(name)
+		if !ok {
+			return nil
+		}
+
+		target := newProxyHandler(pool, services, limiter)
+		if route != nil {
+			applyRouteOptions(target, route)
+		}
+		targets[name] = target
+		return target
+	}
+}
+
+// registerProxyRoutes монтирует маршруты из конфигурации в порядке их объявления,
+// запросы без совпадений уходят в пул по умолчанию
+func registerProxyRoutes(router *mux.Router, services *service.Service) {
+	limiter := handler.NewConcurrencyLimiter(concurrentLimit)
+
+	for _, route := range services.Routes {
+		r := router.NewRoute()
+		if route.Name != "" {
+			r = r.Name(route.Name)
+		}
+		if route.Host != "" {
+			r = r.Host(route.Host)
+		}
+		if route.PathPrefix != "" {
+			r = r.PathPrefix(route.PathPrefix)
+		}
+		if route.PathRegex != nil {
+			re := route.PathRegex
+			r = r.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
+				return re.MatchString(req.URL.Path)
+			})
+		}
+		if len(route.Methods) > 0 {
+			r = r.Methods(route.Methods...)
+		}
+		for name, value := range route.Headers {
+			r = r.Headers(name, value)
+		}
+
+		proxyHandler := newProxyHandler(route.Pool, services, limiter)
+		proxyHandler.UseCanary(route.Pool.Canary, newCanaryTargets(services, route, limiter))
+		applyRouteOptions(proxyHandler, route)
+		r.Handler(proxyHandler)
+	}
+
+	defaultPool, _ := services.Pool(service.DefaultPool)
+	defaultHandler := newProxyHandler(defaultPool, services, limiter)
+	defaultHandler.UseCanary(defaultPool.Canary, newCanaryTargets(services, nil, limiter))
+	router.PathPrefix("/").Handler(defaultHandler)
+}
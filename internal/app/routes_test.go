@@ -0,0 +1,202 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type allowAllLimiter struct{}
+
+func (allowAllLimiter) IsAllowed(clientID string) bool { return true }
+
+func (allowAllLimiter) Stop() {}
+
+// newTestServices создает пулы, бэкенд каждого отвечает именем своего пула.
+// Если задан hold, бэкенд вызывает его перед ответом
+func newTestServices(t *testing.T, poolNames []string, routes []service.RouteConfig, hold func(pool string)) *service.Service {
+	pools := make(map[string]*service.Pool, len(poolNames))
+	services := &service.Service{
+		ClientIdentifier: service.NewClientIdentifierService(false),
+		RateLimiter:      allowAllLimiter{},
+		StickySessions:   service.NewStickySessions(service.StickySessionConfig{}),
+		RetryBudget:      service.NewRetryBudget(service.RetryBudgetConfig{}),
+		UpgradeTracker:   service.NewUpgradeTracker(service.UpgradeConfig{}),
+	}
+
+	for _, name := range poolNames {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hold != nil {
+				hold(name)
+			}
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(backend.Close)
+		backendURL, _ := url.Parse(backend.URL)
+
+		pool, err := service.NewPool(service.PoolConfig{
+			Name:     name,
+			Backends: []service.WeightedBackend{{URL: backendURL, Weight: 1}},
+		})
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		pools[name] = pool
+		services.Pools = append(services.Pools, pool)
+	}
+
+	for _, config := range routes {
+		route, err := service.NewRoute(config, pools)
+		if err != nil {
+			t.Fatalf("failed to create route: %v", err)
+		}
+		services.Routes = append(services.Routes, route)
+	}
+	return services
+}
+
+func TestRegisterProxyRoutes_Matching(t *testing.T) {
+	services := newTestServices(t,
+		[]string{service.DefaultPool, "api", "static", "users", "upload", "v2", "special"},
+		[]service.RouteConfig{
+			{Name: "api", Host: "api.example.com", Pool: "api"},
+			{Name: "static", PathPrefix: "/static/", Pool: "static"},
+			{Name: "special", PathPrefix: "/static/special/", Pool: "special"}, // перекрыт предыдущим маршрутом
+			{Name: "users", PathRegex: `^/users/\d+$`, Pool: "users"},
+			{Name: "upload", PathPrefix: "/upload", Methods: []string{http.MethodPost}, Pool: "upload"},
+			{Name: "v2", Headers: map[string]string{"X-Api-Version": "v2"}, Pool: "v2"},
+		},
+		nil,
+	)
+	router := mux.NewRouter()
+	registerProxyRoutes(router, services)
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		headers map[string]string
+		want    string
+	}{
+		{"host", http.MethodGet, "http://api.example.com/anything", nil, "api"},
+		{"other host", http.MethodGet, "http://web.example.com/anything", nil, service.DefaultPool},
+		{"path prefix", http.MethodGet, "/static/app.js", nil, "static"},
+		{"first match wins", http.MethodGet, "/static/special/app.js", nil, "static"},
+		{"host before path prefix", http.MethodGet, "http://api.example.com/static/app.js", nil, "api"},
+		{"path regex", http.MethodGet, "/users/42", nil, "users"},
+		{"path regex mismatch", http.MethodGet, "/users/me", nil, service.DefaultPool},
+		{"method", http.MethodPost, "/upload/file", nil, "upload"},
+		{"method mismatch", http.MethodGet, "/upload/file", nil, service.DefaultPool},
+		{"header", http.MethodGet, "/orders", map[string]string{"X-Api-Version": "v2"}, "v2"},
+		{"header mismatch", http.MethodGet, "/orders", map[string]string{"X-Api-Version": "v1"}, service.DefaultPool},
+		{"default", http.MethodGet, "/", nil, service.DefaultPool},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("Expected pool %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRegisterProxyRoutes_SharedConcurrencyLimit(t *testing.T) {
+	started := make(chan struct{}, concurrentLimit)
+	release := make(chan struct{})
+	services := newTestServices(t,
+		[]string{service.DefaultPool, "api"},
+		[]service.RouteConfig{{Name: "api", PathPrefix: "/api/", Pool: "api"}},
+		func(pool string) {
+			if pool == service.DefaultPool {
+				started <- struct{}{}
+				<-release
+			}
+		},
+	)
+	router := mux.NewRouter()
+	registerProxyRoutes(router, services)
+
+	// занимаем все слоты одновременных запросов через маршрут по умолчанию
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentLimit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+	defer func() {
+		close(release)
+		wg.Wait()
+	}()
+
+	for i := 0; i < concurrentLimit; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for requests to reach backend")
+		}
+	}
+
+	// ограничение общее, поэтому запрос другого маршрута тоже отклоняется
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestRegisterProxyRoutes_CanaryTargets(t *testing.T) {
+	services := newTestServices(t,
+		[]string{service.DefaultPool, "api", "canary"},
+		[]service.RouteConfig{{Name: "api", PathPrefix: "/api/", Pool: "api"}},
+		nil,
+	)
+	router := mux.NewRouter()
+	registerProxyRoutes(router, services)
+
+	// канареечный пул задается во время работы, обработчик для него создается при первом запросе
+	api, _ := services.Pool("api")
+	if err := api.Canary.Update(service.CanaryConfig{Pool: "canary", Header: "X-Canary"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+		req.Header.Set("X-Canary", "1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if got := w.Body.String(); got != "canary" {
+			t.Errorf("Expected pool canary, got %s", got)
+		}
+	}
+
+	// неизвестный пул: запрос обслуживает основной пул маршрута
+	if err := api.Canary.Update(service.CanaryConfig{Pool: "missing", Header: "X-Canary"}); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+	req.Header.Set("X-Canary", "1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Body.String(); got != "api" {
+		t.Errorf("Expected pool api, got %s", got)
+	}
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/BabyJhon/cloudru-bootcamp/configs"
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthModes = map[string]tls.ClientAuthType{
+	"":         tls.NoClientCert,
+	"none":     tls.NoClientCert,
+	"optional": tls.VerifyClientCertIfGiven,
+	"require":  tls.RequireAndVerifyClientCert,
+}
+
+// newTLSConfig собирает настройки TLS-порта, сертификаты выбираются хранилищем по SNI
+func newTLSConfig(cfg configs.TLSConfig, certificates *service.CertificateStore) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certificates.GetCertificate,
+	}
+
+	if cfg.MinVersion != "" {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls version %q", cfg.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	// наборы шифров применяются только к TLS 1.2 и ниже, небезопасные наборы не допускаются
+	if len(cfg.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range cfg.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+			}
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+
+	// клиентские сертификаты проверяются по заданному УЦ
+	clientAuth, ok := clientAuthModes[cfg.ClientAuth.Mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown client auth mode %q", cfg.ClientAuth.Mode)
+	}
+	if clientAuth != tls.NoClientCert {
+		pool, err := service.LoadCertPool(cfg.ClientAuth.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = clientAuth
+		config.ClientCAs = pool
+	}
+
+	return config, nil
+}
+
+// newTLSServer создает HTTPS-сервер с тем же роутером, что и основной порт
+func newTLSServer(cfg configs.TLSConfig, handler http.Handler, certificates *service.CertificateStore) (*http.Server, error) {
+	tlsConfig, err := newTLSConfig(cfg, certificates)
+	if err != nil {
+		return nil, err
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+
+	return &http.Server{
+		Addr:      ":" + cfg.Port,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+		Protocols: protocols,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package entity
+
+import "time"
+
+// OutlierEjection описывает бэкенд, исключенный из балансировки по результатам ответов
+type OutlierEjection struct {
+	Pool          string    `json:"pool"`
+	Backend       string    `json:"backend"`
+	EjectedUntil  time.Time `json:"ejected_until"`
+	EjectionCount int       `json:"ejection_count"`
+}
+
+// OutlierList представляет список исключенных бэкендов для API-запросов
+type OutlierList struct {
+	Ejections []OutlierEjection `json:"ejections"`
+	Total     int               `json:"total"`
+}
+
+// CircuitBreakerState описывает состояние выключателя бэкенда
+type CircuitBreakerState struct {
+	Pool     string    `json:"pool"`
+	Backend  string    `json:"backend"`
+	State    string    `json:"state"`
+	Since    time.Time `json:"since"`
+	Requests int       `json:"requests"`
+	Failures int       `json:"failures"`
+}
+
+// CircuitBreakerList представляет список выключателей для API-запросов
+type CircuitBreakerList struct {
+	Breakers []CircuitBreakerState `json:"breakers"`
+	Total    int                   `json:"total"`
+}
+
+// BackendLatency описывает среднее время ответа бэкенда
+type BackendLatency struct {
+	Pool     string  `json:"pool"`
+	Backend  string  `json:"backend"`
+	EWMAMs   float64 `json:"ewma_ms"`
+	InFlight int64   `json:"in_flight"`
+}
+
+// BackendLatencyList представляет список задержек бэкендов для API-запросов
+type BackendLatencyList struct {
+	Latencies []BackendLatency `json:"latencies"`
+	Total     int              `json:"total"`
+}
+
+// BackendStatus описывает бэкенд пула и его текущее состояние
+type BackendStatus struct {
+	Pool         string `json:"pool"`
+	URL          string `json:"url"`
+	Weight       int    `json:"weight"`
+	Healthy      bool   `json:"healthy"`
+	Ejected      bool   `json:"ejected"`
+	CircuitState string `json:"circuit_state"`
+	Draining     bool   `json:"draining"`
+	InFlight     int64  `json:"in_flight"`
+}
+
+// BackendList представляет список бэкендов для API-запросов
+type BackendList struct {
+	Backends []BackendStatus `json:"backends"`
+	Total    int             `json:"total"`
+}
+
+// AddBackendRequest представляет запрос на добавление бэкенда в пул
+type AddBackendRequest struct {
+	Pool   string `json:"pool"`
+	URL    string `json:"url" validate:"required,url"`
+	Weight int    `json:"weight" validate:"min=0"`
+}
+
+// DrainBackendRequest представляет запрос на вывод бэкенда из работы
+type DrainBackendRequest struct {
+	Pool string `json:"pool"`
+	URL  string `json:"url" validate:"required,url"`
+}
+
+// RetryBudgetStats описывает состояние общего бюджета повторов
+type RetryBudgetStats struct {
+	Enabled   bool   `json:"enabled"`
+	Window    string `json:"window"`
+	Requests  int    `json:"requests"`
+	Retries   int    `json:"retries"`
+	Available int    `json:"available"`
+	Exhausted uint64 `json:"exhausted"`
+}
+
+// MirrorStats описывает сравнение ответов основного и теневого пулов
+type MirrorStats struct {
+	Pool          string  `json:"pool"`
+	ShadowPool    string  `json:"shadow_pool"`
+	Percent       float64 `json:"percent"`
+	Mirrored      uint64  `json:"mirrored"`
+	Dropped       uint64  `json:"dropped"`
+	Failed        uint64  `json:"failed"`
+	StatusMatches uint64  `json:"status_matches"`
+	StatusDiffers uint64  `json:"status_differs"`
+	PrimaryAvgMs  float64 `json:"primary_avg_ms"`
+	ShadowAvgMs   float64 `json:"shadow_avg_ms"`
+}
+
+// MirrorList представляет список зеркалирований для API-запросов
+type MirrorList struct {
+	Mirrors []MirrorStats `json:"mirrors"`
+	Total   int           `json:"total"`
+}
+
+// CanaryStatus описывает разделение трафика пула с канареечным пулом
+type CanaryStatus struct {
+	Pool        string  `json:"pool"`
+	CanaryPool  string  `json:"canary_pool"`
+	Percent     float64 `json:"percent"`
+	Header      string  `json:"header,omitempty"`
+	HeaderValue string  `json:"header_value,omitempty"`
+	Cookie      string  `json:"cookie,omitempty"`
+	CookieValue string  `json:"cookie_value,omitempty"`
+	Consistent  bool    `json:"consistent"`
+}
+
+// CanaryList представляет список канареечных разделений для API-запросов
+type CanaryList struct {
+	Canaries []CanaryStatus `json:"canaries"`
+	Total    int            `json:"total"`
+}
+
+// UpdateCanaryRequest представляет запрос на изменение разделения трафика пула.
+// Пустой canary_pool выключает разделение
+type UpdateCanaryRequest struct {
+	Pool        string  `json:"pool"`
+	CanaryPool  string  `json:"canary_pool"`
+	Percent     float64 `json:"percent" validate:"min=0,max=100"`
+	Header      string  `json:"header"`
+	HeaderValue string  `json:"header_value"`
+	Cookie      string  `json:"cookie"`
+	CookieValue string  `json:"cookie_value"`
+	Consistent  bool    `json:"consistent"`
+}
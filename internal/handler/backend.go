@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/entity"
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type BackendHandler struct {
+	pools          []*service.Pool
+	backendService *service.BackendService
+}
+
+func NewBackendHandler(pools []*service.Pool, backendService *service.BackendService) *BackendHandler {
+	return &BackendHandler{
+		pools:          pools,
+		backendService: backendService,
+	}
+}
+
+func (h *BackendHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/api/backends", h.ListBackends).Methods("GET")
+	router.HandleFunc("/api/backends", h.AddBackend).Methods("POST")
+	router.HandleFunc("/api/backends", h.RemoveBackend).Methods("DELETE")
+	router.HandleFunc("/api/backends/drain", h.DrainBackend).Methods("POST")
+	router.HandleFunc("/api/backends/drain", h.UndrainBackend).Methods("DELETE")
+	router.HandleFunc("/api/backends/outliers", h.ListOutliers).Methods("GET")
+	router.HandleFunc("/api/backends/circuit-breakers", h.ListCircuitBreakers).Methods("GET")
+	router.HandleFunc("/api/backends/latency", h.ListLatencies).Methods("GET")
+	router.HandleFunc("/api/backends/mirrors", h.ListMirrors).Methods("GET")
+	router.HandleFunc("/api/backends/canary", h.ListCanaries).Methods("GET")
+	router.HandleFunc("/api/backends/canary", h.UpdateCanary).Methods("PUT")
+}
+
+// writeBackendError переводит ошибку сервиса в код ответа
+func writeBackendError(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	switch {
+	case errors.Is(err, service.ErrPoolNotFound), errors.Is(err, service.ErrBackendNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, service.ErrBackendExists), errors.Is(err, service.ErrLastBackend):
+		code = http.StatusConflict
+	case errors.Is(err, service.ErrInvalidCanary):
+		code = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(entity.ErrorResponse{
+		Code:    code,
+		Message: err.Error(),
+	})
+}
+
+// ListBackends возвращает бэкенды с их состоянием, пул можно указать параметром pool
+func (h *BackendHandler) ListBackends(w http.ResponseWriter, r *http.Request) {
+	response, err := h.backendService.ListBackends(r.URL.Query().Get("pool"))
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *BackendHandler) AddBackend(w http.ResponseWriter, r *http.Request) {
+	var req entity.AddBackendRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(entity.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := h.backendService.AddBackend(&req); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// RemoveBackend удаляет бэкенд, заданный параметрами pool и url
+func (h *BackendHandler) RemoveBackend(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if err := h.backendService.RemoveBackend(query.Get("pool"), query.Get("url")); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// DrainBackend выводит бэкенд из работы: текущие запросы завершаются, новые не поступают
+func (h *BackendHandler) DrainBackend(w http.ResponseWriter, r *http.Request) {
+	var req entity.DrainBackendRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(entity.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := h.backendService.SetDraining(req.Pool, req.URL, true); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// UndrainBackend возвращает бэкенд, заданный параметрами pool и url, в балансировку
+func (h *BackendHandler) UndrainBackend(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if err := h.backendService.SetDraining(query.Get("pool"), query.Get("url"), false); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// ListOutliers возвращает бэкенды всех пулов, исключенные из балансировки детектором выбросов
+func (h *BackendHandler) ListOutliers(w http.ResponseWriter, r *http.Request) {
+	ejections := []entity.OutlierEjection{}
+	for _, pool := range h.pools {
+		for _, ejection := range pool.OutlierDetector.Ejections() {
+			ejection.Pool = pool.Name
+			ejections = append(ejections, ejection)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entity.OutlierList{
+		Ejections: ejections,
+		Total:     len(ejections),
+	})
+}
+
+// ListCircuitBreakers возвращает состояние выключателей бэкендов всех пулов
+func (h *BackendHandler) ListCircuitBreakers(w http.ResponseWriter, r *http.Request) {
+	breakers := []entity.CircuitBreakerState{}
+	for _, pool := range h.pools {
+		for _, breaker := range pool.CircuitBreakers.States() {
+			breaker.Pool = pool.Name
+			breakers = append(breakers, breaker)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entity.CircuitBreakerList{
+		Breakers: breakers,
+		Total:    len(breakers),
+	})
+}
+
+// ListLatencies возвращает среднее время ответа бэкендов в пулах со стратегией ewma
+func (h *BackendHandler) ListLatencies(w http.ResponseWriter, r *http.Request) {
+	latencies := []entity.BackendLatency{}
+	for _, pool := range h.pools {
+		ewma, ok := pool.Balancer.(*service.EWMABalancer)
+		if !ok {
+			continue
+		}
+		for _, latency := range ewma.Latencies() {
+			latency.Pool = pool.Name
+			latencies = append(latencies, latency)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entity.BackendLatencyList{
+		Latencies: latencies,
+		Total:     len(latencies),
+	})
+}
+
+// ListMirrors возвращает статистику копирования запросов в теневые пулы
+func (h *BackendHandler) ListMirrors(w http.ResponseWriter, r *http.Request) {
+	mirrors := []entity.MirrorStats{}
+	for _, pool := range h.pools {
+		if pool.Mirror == nil {
+			continue
+		}
+		stats := pool.Mirror.Stats()
+		stats.Pool = pool.Name
+		mirrors = append(mirrors, stats)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entity.MirrorList{
+		Mirrors: mirrors,
+		Total:   len(mirrors),
+	})
+}
+
+// ListCanaries возвращает настройки разделения трафика с канареечными пулами
+func (h *BackendHandler) ListCanaries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.backendService.ListCanaries())
+}
+
+// UpdateCanary меняет процент и правила отправки запросов пула в канареечный пул
+func (h *BackendHandler) UpdateCanary(w http.ResponseWriter, r *http.Request) {
+	var req entity.UpdateCanaryRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(entity.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := h.backendService.UpdateCanary(&req); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// requestBody хранит тело запроса для повторных попыток.
+// Небольшое тело держится в памяти, большое сбрасывается во временный файл
+// или передается потоком без возможности повтора
+type requestBody struct {
+	data       []byte
+	file       *os.File
+	size       int64
+	replayable bool
+}
+
+// newReader возвращает новое чтение тела с начала
+func (b *requestBody) newReader() io.ReadCloser {
+	if b.file != nil {
+		return io.NopCloser(io.NewSectionReader(b.file, 0, b.size))
+	}
+	return io.NopCloser(bytes.NewReader(b.data))
+}
+
+// empty сообщает, что тело повторять не нужно
+func (b *requestBody) empty() bool {
+	return b.file == nil && len(b.data) == 0
+}
+
+// close удаляет временный файл тела
+func (b *requestBody) close() {
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+	}
+}
+
+// streamBody передает уже прочитанное начало тела и остаток из исходного запроса
+type streamBody struct {
+	io.Reader
+	io.Closer
+}
+
+// writeBodyError отвечает клиенту, чье тело запроса не удалось прочитать
+func writeBodyError(w http.ResponseWriter, requestID string, err error) {
+	if wrapper, ok := w.(*responseWriterWrapper); ok && wrapper.written.Load() {
+		return
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		log.Printf("[BODY][%s] Request body exceeds limit of %d bytes", requestID, maxBytesErr.Limit)
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	log.Printf("[ERROR][%s] Failed to read request body: %v", requestID, err)
+	http.Error(w, "Failed to read request body", http.StatusBadRequest)
+}
+
+// SetRequestBodyLimits задает ограничения на размер тела запроса и его буферизацию
+func (h *ProxyHandler) SetRequestBodyLimits(config service.RequestBodyConfig) {
+	if config.ReplayBufferSize <= 0 {
+		config.ReplayBufferSize = h.bodyConfig.ReplayBufferSize
+	}
+	h.bodyConfig = config
+}
+
+// prepareBody читает тело запроса в буфер повторов. Тело больше буфера
+// сбрасывается во временный файл или передается потоком, тогда повторы запрещены
+func (h *ProxyHandler) prepareBody(r *http.Request) (*requestBody, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return &requestBody{replayable: true}, nil
+	}
+
+	config := h.bodyConfig
+	body := r.Body
+	if config.MaxSize > 0 {
+		if r.ContentLength > config.MaxSize {
+			r.Body.Close()
+			return nil, &http.MaxBytesError{Limit: config.MaxSize}
+		}
+		body = http.MaxBytesReader(nil, r.Body, config.MaxSize)
+	}
+
+	buf := h.bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer h.bufferPool.Put(buf)
+
+	_, err := io.CopyN(buf, body, config.ReplayBufferSize+1)
+	if errors.Is(err, io.EOF) {
+		r.Body.Close()
+		data := make([]byte, buf.Len())
+		copy(data, buf.Bytes())
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		return &requestBody{data: data, size: int64(len(data)), replayable: true}, nil
+	}
+	if err != nil {
+		r.Body.Close()
+		return nil, err
+	}
+
+	if !config.SpillToDisk {
+		prefix := bytes.Clone(buf.Bytes())
+		r.Body = &streamBody{Reader: io.MultiReader(bytes.NewReader(prefix), body), Closer: r.Body}
+		return &requestBody{}, nil
+	}
+
+	defer r.Body.Close()
+	file, err := os.CreateTemp(config.SpillDir, "proxy-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file for request body: %w", err)
+	}
+	spilled := &requestBody{file: file, replayable: true}
+
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		spilled.close()
+		return nil, err
+	}
+	rest, err := io.Copy(file, body)
+	if err != nil {
+		spilled.close()
+		return nil, err
+	}
+	spilled.size = int64(buf.Len()) + rest
+
+	r.Body = spilled.newReader()
+	return spilled, nil
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// CanaryTargets возвращает обработчик пула по имени или nil, если такого пула нет
+type CanaryTargets func(pool string) http.Handler
+
+// UseCanary включает отправку части запросов в канареечный пул.
+// targets - обработчики пулов по имени, сами они разделение трафика не выполняют
+func (h *ProxyHandler) UseCanary(canary *service.Canary, targets CanaryTargets) {
+	h.canary = canary
+	h.canaryTargets = targets
+}
+
+// canaryTarget возвращает обработчик канареечного пула, если запрос должен уйти в него
+func (h *ProxyHandler) canaryTarget(r *http.Request) (string, http.Handler) {
+	if h.canary == nil {
+		return "", nil
+	}
+
+	pool, ok := h.canary.Route(r, h.clientIdentifier.IdentifyClient(r))
+	if !ok {
+		return "", nil
+	}
+	target := h.canaryTargets(pool)
+	if target == nil {
+		log.Printf("[CANARY] Unknown canary pool %q, serving request from primary pool", pool)
+		return "", nil
+	}
+	return pool, target
+}
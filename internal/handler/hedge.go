@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// hedgeResult описывает результат одной из параллельных попыток
+type hedgeResult struct {
+	req    *http.Request
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+func (r hedgeResult) ok() bool {
+	return r.err == nil && r.resp.StatusCode < 500
+}
+
+// hedgingTransport отправляет копию GET-запроса на другой бэкенд, если первый
+// не ответил за время, рассчитанное политикой, и возвращает первый успешный ответ
+type hedgingTransport struct {
+	next    http.RoundTripper
+	policy  *service.HedgePolicy
+	handler *ProxyHandler
+}
+
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tried, _ := req.Context().Value(triedKey).(*triedBackends)
+	body, _ := req.Context().Value(requestBodyKey).(*requestBody)
+	if req.Method != http.MethodGet || req.Header.Get("Upgrade") != "" || tried == nil ||
+		body != nil && !body.replayable {
+		return t.next.RoundTrip(req)
+	}
+
+	results := make(chan hedgeResult, 2)
+	send := func(r *http.Request, cancel context.CancelFunc) {
+		start := time.Now()
+		resp, err := t.next.RoundTrip(r)
+		if err == nil && resp.StatusCode < 500 {
+			t.policy.ObserveLatency(time.Since(start))
+		}
+		results <- hedgeResult{req: r, resp: resp, err: err, cancel: cancel}
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	primary := req.WithContext(ctx)
+	cancels := map[*http.Request]context.CancelFunc{primary: cancel}
+	go send(primary, cancel)
+
+	delay := t.policy.Delay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	// неудачный ответ основной попытки придерживаем: ошибку ReverseProxy
+	// передаст в errorHandler вместе с исходным запросом
+	var held *hedgeResult
+	timerC := timer.C
+	pending := 1
+	for pending > 0 {
+		select {
+		case <-timerC:
+			timerC = nil
+			hedgeReq, hedgeCancel := t.hedgeRequest(req, tried)
+			if hedgeReq == nil {
+				continue
+			}
+			requestID, _ := req.Context().Value(requestIDKey).(string)
+			log.Printf("[HEDGE][%s] No response within %v, sending hedged request to %s",
+				requestID, delay, hedgeReq.URL.Host)
+			cancels[hedgeReq] = hedgeCancel
+			pending++
+			go send(hedgeReq, hedgeCancel)
+
+		case result := <-results:
+			pending--
+			if result.ok() {
+				return t.win(result, held, cancels, pending, results)
+			}
+
+			// дубль еще не отправлен - неудача обрабатывается обычными повторами
+			if timerC != nil {
+				return t.win(result, held, cancels, pending, results)
+			}
+			if result.req == primary {
+				held = &result
+			} else {
+				t.discard(result)
+			}
+		}
+	}
+
+	// обе попытки неудачны, возвращаем результат основной
+	return t.win(*held, nil, cancels, 0, results)
+}
+
+// win возвращает ответ победителя и отменяет остальные попытки
+func (t *hedgingTransport) win(winner hedgeResult, held *hedgeResult,
+	cancels map[*http.Request]context.CancelFunc, pending int, results <-chan hedgeResult) (*http.Response, error) {
+	if held != nil {
+		t.discard(*held)
+	}
+	for req, cancel := range cancels {
+		if req != winner.req {
+			cancel()
+		}
+	}
+	go func() {
+		for i := 0; i < pending; i++ {
+			t.discard(<-results)
+		}
+	}()
+
+	if winner.err != nil {
+		winner.cancel()
+		return nil, winner.err
+	}
+
+	// запрос победителя отменяется только после чтения тела ответа
+	winner.resp.Body = &attemptBody{ReadCloser: winner.resp.Body, onClose: winner.cancel}
+	return winner.resp, nil
+}
+
+// discard закрывает проигравшую попытку и учитывает ее неудачу, если она не была отменена
+func (t *hedgingTransport) discard(result hedgeResult) {
+	if result.resp != nil {
+		result.resp.Body.Close()
+	}
+	result.cancel()
+	t.handler.finishAttempt(result.req.Context())
+
+	backend, _ := result.req.Context().Value(currentBackendKey).(*url.URL)
+	switch {
+	case result.err == nil && result.resp.StatusCode >= 500:
+		t.handler.reportFailure(backend)
+	case result.err != nil && !errors.Is(result.err, context.Canceled) && !errors.Is(result.err, service.ErrCircuitOpen):
+		t.handler.reportFailure(backend)
+	}
+}
+
+// hedgeRequest готовит копию запроса на еще не опробованный бэкенд
+func (t *hedgingTransport) hedgeRequest(req *http.Request, tried *triedBackends) (*http.Request, context.CancelFunc) {
+	backend := t.handler.nextUntried(tried)
+	if backend == nil {
+		return nil, nil
+	}
+	t.handler.balancer.RequestStarted(backend)
+	tried.add(backend)
+
+	ctx := context.WithValue(req.Context(), currentBackendKey, backend)
+	ctx = context.WithValue(ctx, attemptKey, &backendAttempt{backend: backend, start: time.Now()})
+	ctx, cancel := context.WithCancel(ctx)
+
+	hedgeReq := req.Clone(ctx)
+	if body, ok := req.Context().Value(requestBodyKey).(*requestBody); ok && !body.empty() {
+		hedgeReq.Body = body.newReader()
+	}
+	hedgeReq.URL.Scheme = backend.Scheme
+	hedgeReq.URL.Host = backend.Host
+	hedgeReq.Host = backend.Host
+
+	return hedgeReq, cancel
+}
+
+// UseHedging включает дублирование GET-запросов по политике маршрута.
+// Вызывается после UseCircuitBreakers, чтобы каждая попытка проходила через выключатель
+func (h *ProxyHandler) UseHedging(policy *service.HedgePolicy) {
+	h.proxy.Transport = &hedgingTransport{
+		next:    h.proxy.Transport,
+		policy:  policy,
+		handler: h,
+	}
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// maxMirrorsInFlight ограничивает число одновременных теневых запросов,
+// лишние копии отбрасываются, чтобы не копить горутины при медленном теневом пуле
+const maxMirrorsInFlight = 100
+
+// hopHeaders относятся к соединению клиента с прокси и не передаются дальше, как в httputil.ReverseProxy
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders удаляет hop-by-hop заголовки, включая перечисленные в Connection
+func removeHopHeaders(header http.Header) {
+	for _, value := range header["Connection"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// mirrorResult описывает ответ основного пула для сравнения с теневым
+type mirrorResult struct {
+	statusCode int
+	latency    time.Duration
+}
+
+// UseMirror включает копирование части запросов в теневой пул
+func (h *ProxyHandler) UseMirror(mirror *service.Mirror) {
+	h.mirror = mirror
+	h.mirrorSlots = make(chan struct{}, maxMirrorsInFlight)
+	h.mirrorClient = &http.Client{
+		// теневой пул опрашивается по своему протоколу и со своими настройками TLS
+		Transport: service.NewUpstreamTransport(mirror.Shadow.Protocol, mirror.Shadow.TLSConfig),
+		// редиректы теневого пула не выполняем
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// startMirror отправляет копию запроса в теневой пул, не дожидаясь ответа.
+// Возвращает канал, в который передается результат основного запроса, или nil,
+// если запрос не копируется. Копируются только запросы с телом в памяти и без переключения протокола
+func (h *ProxyHandler) startMirror(r *http.Request, body *requestBody) chan<- mirrorResult {
+	if h.mirror == nil || isUpgradeRequest(r) || !body.replayable || body.file != nil || !h.mirror.ShouldMirror() {
+		return nil
+	}
+
+	select {
+	case h.mirrorSlots <- struct{}{}:
+	default:
+		h.mirror.RecordDropped()
+		return nil
+	}
+
+	requestID, _ := r.Context().Value(requestIDKey).(string)
+	backend := h.mirror.Shadow.Balancer.Next()
+	if backend == nil {
+		<-h.mirrorSlots
+		return nil
+	}
+
+	// теневой запрос не зависит от отмены клиентского запроса
+	ctx, cancel := context.WithTimeout(context.Background(), h.mirror.Timeout())
+	shadowReq := r.Clone(ctx)
+	shadowReq.RequestURI = ""
+	shadowReq.Body = nil
+	if !body.empty() {
+		shadowReq.Body = io.NopCloser(bytes.NewReader(body.data))
+	}
+	shadowReq.URL.Scheme = backend.Scheme
+	shadowReq.URL.Host = backend.Host
+	removeHopHeaders(shadowReq.Header)
+	shadowReq.Header.Set("X-Forwarded-Host", r.Host)
+	shadowReq.Host = backend.Host
+
+	primary := make(chan mirrorResult, 1)
+	go func() {
+		defer func() { <-h.mirrorSlots }()
+		defer cancel()
+
+		shadow := h.mirror.Shadow.Balancer
+		shadow.RequestStarted(backend)
+		defer shadow.RequestFinished(backend)
+
+		start := time.Now()
+		resp, err := h.mirrorClient.Do(shadowReq)
+		if err != nil {
+			h.mirror.RecordFailure()
+			log.Printf("[MIRROR][%s] Shadow backend %s failed: %v", requestID, backend, err)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		shadowLatency := time.Since(start)
+
+		result := <-primary
+		h.mirror.Record(result.statusCode, result.latency, resp.StatusCode, shadowLatency)
+		if result.statusCode != resp.StatusCode {
+			log.Printf("[MIRROR][%s] Status mismatch: primary %d in %v, shadow %s %d in %v",
+				requestID, result.statusCode, result.latency, backend, resp.StatusCode, shadowLatency)
+		}
+	}()
+
+	return primary
+}
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -23,9 +22,23 @@ type ProxyHandler struct {
 	rateLimiter      service.RateLimiterService
 	clientIdentifier service.ClientIdentifier
 	proxy            *httputil.ReverseProxy
-	maxRetries       int
+	transport        *http.Transport // базовый транспорт к бэкендам, остальные его оборачивают
+	retryPolicy      *service.RetryPolicy
+	retryBudget      *service.RetryBudget
+	timeout          time.Duration
 	bufferPool       *sync.Pool // пул буферов для тела запроса
+	bodyConfig       service.RequestBodyConfig
 	semaphore        chan struct{}
+	observers        []service.BackendObserver
+	sticky           *service.StickySessions
+	stickyPool       string
+	mirror           *service.Mirror
+	mirrorClient     *http.Client
+	mirrorSlots      chan struct{}
+	canary           *service.Canary
+	canaryTargets    CanaryTargets
+	upgrades         *service.UpgradeTracker
+	streaming        *service.StreamingConfig // nil, если маршрут не потоковый
 	// защита от повторной записи заголовков
 	responseWritten sync.Map
 }
@@ -34,16 +47,40 @@ type contextKey string
 
 const (
 	retriesKey        contextKey = "retries"
-	originalBodyKey   contextKey = "originalBody"
+	requestBodyKey    contextKey = "requestBody"
 	currentBackendKey contextKey = "currentBackend"
 	startTimeKey      contextKey = "startTime"
 	requestIDKey      contextKey = "requestID"
+	attemptKey        contextKey = "attempt"
+	clientIDKey       contextKey = "clientID"
+	stickyBackendKey  contextKey = "stickyBackend"
+	triedKey          contextKey = "triedBackends"
 )
 
+// backendAttempt описывает одну попытку отправки запроса на бэкенд
+type backendAttempt struct {
+	backend *url.URL
+	start   time.Time // начало именно этой попытки, без предыдущих попыток и задержек
+	once    sync.Once
+}
+
+// attemptBody завершает попытку, когда ReverseProxy дочитал и закрыл тело ответа
+type attemptBody struct {
+	io.ReadCloser
+	onClose func()
+}
+
+func (b *attemptBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.onClose()
+	return err
+}
+
 // обертка для отслеживания записи заголовков
 type responseWriterWrapper struct {
 	http.ResponseWriter
 	written      atomic.Bool
+	statusCode   int
 	requestID    string
 	proxyHandler *ProxyHandler
 }
@@ -54,6 +91,7 @@ func (w *responseWriterWrapper) WriteHeader(statusCode int) {
 		return
 	}
 	w.written.Store(true)
+	w.statusCode = statusCode
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
@@ -67,52 +105,61 @@ func (w *responseWriterWrapper) Write(b []byte) (int, error) {
 
 func NewProxyHandler(balancer service.Balancer, rateLimiter service.RateLimiterService,
 	clientIdentifier service.ClientIdentifier, concurrentLimit int) *ProxyHandler {
-	if concurrentLimit <= 0 {
-		concurrentLimit = 100
-	}
-
 	ph := &ProxyHandler{
 		balancer:         balancer,
 		rateLimiter:      rateLimiter,
 		clientIdentifier: clientIdentifier,
-		maxRetries:       len(balancer.GetBackends()),
+		retryPolicy:      service.NewRetryPolicy(service.RetryPolicyConfig{}),
+		timeout:          60 * time.Second,
 		bufferPool:       &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }},
-		semaphore:        make(chan struct{}, concurrentLimit),
+		semaphore:        NewConcurrencyLimiter(concurrentLimit),
+		bodyConfig:       service.RequestBodyConfig{ReplayBufferSize: 1 << 20},
 	}
 
 	director := func(req *http.Request) {
 		requestID, _ := req.Context().Value(requestIDKey).(string)
+		retries, _ := req.Context().Value(retriesKey).(int)
 
-		// сохраняем тело запроса при первом обращении для возможных повторных попыток
-		if req.Context().Value(originalBodyKey) == nil && req.Body != nil {
-			buf := ph.bufferPool.Get().(*bytes.Buffer)
-			buf.Reset()
-			defer ph.bufferPool.Put(buf)
-
-			_, err := io.Copy(buf, req.Body)
-			req.Body.Close()
-			if err != nil {
-				log.Printf("[ERROR][%s] Failed to read request body: %v", requestID, err)
-				return
-			}
-
-			bodyBytes := make([]byte, buf.Len())
-			copy(bodyBytes, buf.Bytes())
-			ctx := context.WithValue(req.Context(), originalBodyKey, bodyBytes)
-			*req = *req.WithContext(ctx)
+		// запросы клиента закрепляются за бэкендом, повторные попытки идут на другие бэкенды
+		var target *url.URL
+		keyed, ok := ph.balancer.(service.KeyedBalancer)
+		pinned, _ := req.Context().Value(stickyBackendKey).(*url.URL)
+		clientID, _ := req.Context().Value(clientIDKey).(string)
+		tried, _ := req.Context().Value(triedKey).(*triedBackends)
+		switch {
+		case retries > 0 && tried != nil:
+			target = ph.nextUntried(tried)
+		case retries > 0:
+			target = ph.balancer.Next()
+		case pinned != nil:
+			target = pinned
+		case ok && clientID != "":
+			target = keyed.NextForKey(clientID)
+		default:
+			target = ph.balancer.Next()
+		}
 
-			req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+		// в пуле не осталось доступных бэкендов: запрос не уходит никуда, errorHandler ответит 503
+		if target == nil {
+			log.Printf("[ROUTING][%s] No available backend", requestID)
+			*req = *req.WithContext(context.WithValue(req.Context(), currentBackendKey, target))
+			req.URL.Scheme = ""
+			req.URL.Host = ""
+			return
 		}
 
-		target := ph.balancer.Next()
+		ph.balancer.RequestStarted(target)
+		if tried != nil {
+			tried.add(target)
+		}
 
 		ctx := context.WithValue(req.Context(), currentBackendKey, target)
+		ctx = context.WithValue(ctx, attemptKey, &backendAttempt{backend: target, start: time.Now()})
 		*req = *req.WithContext(ctx)
 
-		retries, _ := req.Context().Value(retriesKey).(int)
 		if retries > 0 {
 			log.Printf("[RETRY][%s] %d/%d Routing request to: %s",
-				requestID, retries, ph.maxRetries-1, target.String())
+				requestID, retries, ph.maxAttempts()-1, target.String())
 		} else {
 			log.Printf("[ROUTING][%s] Request forwarded to backend: %s",
 				requestID, target.String())
@@ -124,53 +171,151 @@ func NewProxyHandler(balancer service.Balancer, rateLimiter service.RateLimiterS
 		req.Host = target.Host
 	}
 
+	ph.transport = service.NewUpstreamTransport(service.ProtocolHTTP1, nil)
+
 	ph.proxy = &httputil.ReverseProxy{
 		Director:       director,
 		ErrorHandler:   ph.errorHandler,
 		ModifyResponse: ph.modifyResponse,
-		Transport: &http.Transport{
-			MaxIdleConns:          100,
-			MaxIdleConnsPerHost:   10,
-			IdleConnTimeout:       30 * time.Second,
-			ResponseHeaderTimeout: 10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-		},
+		Transport:      ph.transport,
 	}
 
 	return ph
 }
 
+// SetTimeout задает таймаут запроса, если в контексте запроса его еще нет
+func (h *ProxyHandler) SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		h.timeout = timeout
+	}
+}
+
+// statusError возвращается из modifyResponse, когда бэкенд ответил 5xx
+type statusError struct {
+	backend    *url.URL
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("backend server %s returned error status: %d", e.backend, e.statusCode)
+}
+
+// AddObserver подписывает наблюдателя на результаты запросов к бэкендам
+func (h *ProxyHandler) AddObserver(observer service.BackendObserver) {
+	h.observers = append(h.observers, observer)
+}
+
+func (h *ProxyHandler) reportSuccess(backend *url.URL) {
+	for _, observer := range h.observers {
+		observer.ReportSuccess(backend)
+	}
+}
+
+func (h *ProxyHandler) reportFailure(backend *url.URL) {
+	for _, observer := range h.observers {
+		observer.ReportFailure(backend)
+	}
+}
+
+// finishAttempt сообщает балансировщику о завершении попытки, повторные вызовы игнорируются
+func (h *ProxyHandler) finishAttempt(ctx context.Context) {
+	if attempt, ok := ctx.Value(attemptKey).(*backendAttempt); ok {
+		attempt.once.Do(func() { h.balancer.RequestFinished(attempt.backend) })
+	}
+}
+
+// observeAttempt сообщает балансировщику время ответа попытки, неудачные попытки учитываются со штрафом
+func (h *ProxyHandler) observeAttempt(ctx context.Context, failed bool) {
+	observer, ok := h.balancer.(service.LatencyObserver)
+	attempt, _ := ctx.Value(attemptKey).(*backendAttempt)
+	if !ok || attempt == nil {
+		return
+	}
+
+	duration := time.Since(attempt.start)
+	if failed {
+		observer.ObserveFailure(attempt.backend, duration)
+	} else {
+		observer.ObserveLatency(attempt.backend, duration)
+	}
+}
+
 func (h *ProxyHandler) modifyResponse(resp *http.Response) error {
 	requestID, _ := resp.Request.Context().Value(requestIDKey).(string)
+	currentBackend, _ := resp.Request.Context().Value(currentBackendKey).(*url.URL)
+
+	// запрос к бэкенду завершается вместе с телом ответа. Тело ответа 101 Switching Protocols
+	// ReverseProxy использует как соединение, поэтому его не оборачиваем
+	ctx := resp.Request.Context()
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		h.finishAttempt(ctx)
+	} else {
+		resp.Body = &attemptBody{ReadCloser: resp.Body, onClose: func() { h.finishAttempt(ctx) }}
+	}
 
 	// если ответ успешный, логируем информацию
 	if resp.StatusCode < 500 {
-		currentBackend, _ := resp.Request.Context().Value(currentBackendKey).(*url.URL)
 		startTime, _ := resp.Request.Context().Value(startTimeKey).(time.Time)
 		duration := time.Since(startTime)
 
 		log.Printf("[SUCCESS][%s] Backend %s returned status %d in %v",
 			requestID, currentBackend, resp.StatusCode, duration)
+		h.reportSuccess(currentBackend)
+		h.setAffinityCookie(resp, currentBackend)
+		h.observeAttempt(ctx, false)
 		return nil
 	}
 
-	currentBackend, _ := resp.Request.Context().Value(currentBackendKey).(*url.URL)
-	return fmt.Errorf("backend server %s returned error status: %d", currentBackend, resp.StatusCode)
+	h.reportFailure(currentBackend)
+	h.observeAttempt(ctx, true)
+
+	// ответ, который не будет повторен, отдаем клиенту как есть
+	if !h.canRetry(resp.Request, resp.StatusCode, nil) {
+		log.Printf("[ERROR][%s] Backend %s returned status %d, not retrying",
+			requestID, currentBackend, resp.StatusCode)
+		return nil
+	}
+	return &statusError{backend: currentBackend, statusCode: resp.StatusCode}
 }
 
 func (h *ProxyHandler) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
 	requestID, _ := r.Context().Value(requestIDKey).(string)
 	retries, _ := r.Context().Value(retriesKey).(int)
 	currentBackend, _ := r.Context().Value(currentBackendKey).(*url.URL)
+	h.finishAttempt(r.Context())
+
+	if currentBackend == nil {
+		log.Printf("[FAILED][%s] No available backend: %v", requestID, err)
+		if wrapper, ok := w.(*responseWriterWrapper); !ok || !wrapper.written.Load() {
+			http.Error(w, "No available backends", http.StatusServiceUnavailable)
+		}
+		return
+	}
+
+	// тело, переданное потоком, оказалось больше допустимого - бэкенд здесь ни при чем
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeBodyError(w, requestID, err)
+		return
+	}
 
-	// проверяем, не превышен ли лимит попыток
-	if retries >= h.maxRetries-1 {
-		log.Printf("[FAILED][%s] Max retries reached (%d/%d). Last error from %s: %v",
-			requestID, retries+1, h.maxRetries, currentBackend, err)
+	// ответы 5xx уже учтены в modifyResponse, здесь учитываем ошибки соединения.
+	// Отмена запроса клиентом и разомкнутый выключатель не говорят о новых проблемах бэкенда
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, service.ErrCircuitOpen) {
+		h.reportFailure(currentBackend)
+		h.observeAttempt(r.Context(), true)
+	}
+
+	// ответы 5xx приходят сюда, только если modifyResponse уже решил их повторить
+	retry := statusCodeOf(err) > 0 || h.canRetry(r, 0, err)
+	if retry && !h.waitBackoff(r.Context(), retries+1) {
+		retry = false
+	}
+
+	if !retry {
+		log.Printf("[FAILED][%s] Giving up after %d/%d attempts. Last error from %s: %v",
+			requestID, retries+1, h.maxAttempts(), currentBackend, err)
 
 		startTime, _ := r.Context().Value(startTimeKey).(time.Time)
 		duration := time.Since(startTime)
@@ -190,33 +335,48 @@ func (h *ProxyHandler) errorHandler(w http.ResponseWriter, r *http.Request, err
 			}
 		}
 
-		// освобождаем семафор
-		select {
-		case <-h.semaphore:
-		default:
-		}
-
 		return
 	}
 
 	newCtx := context.WithValue(r.Context(), retriesKey, retries+1)
 
 	// восстанавливаем тело запроса
-	if bodyBytes, ok := r.Context().Value(originalBodyKey).([]byte); ok && len(bodyBytes) > 0 {
+	if body, ok := r.Context().Value(requestBodyKey).(*requestBody); ok && !body.empty() {
 		r = r.Clone(newCtx)
-		r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+		r.Body = body.newReader()
 	} else {
 		r = r.WithContext(newCtx)
 	}
 
 	log.Printf("[ERROR][%s] Backend %s returned error: %v. Retrying request (attempt %d/%d)...",
-		requestID, currentBackend, err, retries+1, h.maxRetries)
+		requestID, currentBackend, err, retries+1, h.maxAttempts())
 
 	// выполняем следующую попытку синхронно, а не в горутине
 	h.proxy.ServeHTTP(w, r)
 }
 
+// NewConcurrencyLimiter создает ограничение одновременных запросов,
+// которое можно разделить между несколькими обработчиками
+func NewConcurrencyLimiter(limit int) chan struct{} {
+	if limit <= 0 {
+		limit = 100
+	}
+	return make(chan struct{}, limit)
+}
+
+// SetConcurrencyLimiter заменяет собственное ограничение одновременных запросов общим
+func (h *ProxyHandler) SetConcurrencyLimiter(limiter chan struct{}) {
+	h.semaphore = limiter
+}
+
 func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// канареечный пул сам применяет лимиты, поэтому запрос передается ему до их проверки
+	if pool, canary := h.canaryTarget(r); canary != nil {
+		log.Printf("[CANARY] %s %s routed to canary pool %s", r.Method, r.URL.Path, pool)
+		canary.ServeHTTP(w, r)
+		return
+	}
+
 	requestID := fmt.Sprintf("%d-%s", time.Now().UnixNano(), r.RemoteAddr)
 	clientID := h.clientIdentifier.IdentifyClient(r)
 
@@ -229,6 +389,19 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// WebSocket и другие Upgrade-соединения ограничиваются на клиента
+	upgrade := isUpgradeRequest(r)
+	if upgrade && h.upgrades != nil {
+		if err := h.upgrades.Acquire(clientID); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": "Too many upgraded connections"}`))
+			log.Printf("[UPGRADE][%s] Upgrade from client %s rejected: %v", requestID, clientID, err)
+			return
+		}
+		defer h.upgrades.Release(clientID)
+	}
+
 	// логируем входящий запрос
 	startTime := time.Now()
 	remoteIP := r.RemoteAddr
@@ -238,12 +411,32 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[REQUEST][%s] %s %s from %s, User-Agent: %s, X-Forwarded-For: %s",
 		requestID, r.Method, r.URL.String(), remoteIP, userAgent, xForwardedFor)
 
+	if h.retryBudget != nil {
+		h.retryBudget.RecordRequest()
+	}
+
 	// Используем контекст из запроса, если он уже содержит таймаут
 	ctx := r.Context()
-	if _, ok := ctx.Deadline(); !ok {
+	if upgrade && h.upgrades != nil {
+		// переключенное соединение живет дольше обычного запроса, его срок ограничивает max lifetime
+		var cancel context.CancelFunc
+		if lifetime := h.upgrades.Config().MaxLifetime; lifetime > 0 {
+			ctx, cancel = context.WithTimeout(ctx, lifetime)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+		defer cancel()
+	} else if h.streaming != nil {
+		// потоковый ответ может длиться дольше таймаута пула
+		if h.streaming.MaxDuration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, h.streaming.MaxDuration)
+			defer cancel()
+		}
+	} else if _, ok := ctx.Deadline(); !ok {
 		// Если в контексте нет таймаута, создаем новый с таймаутом по умолчанию
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 60*time.Second)
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
 		defer cancel()
 	}
 
@@ -251,6 +444,11 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx = context.WithValue(ctx, retriesKey, 0)
 	ctx = context.WithValue(ctx, startTimeKey, startTime)
 	ctx = context.WithValue(ctx, requestIDKey, requestID)
+	ctx = context.WithValue(ctx, clientIDKey, clientID)
+	ctx = context.WithValue(ctx, triedKey, newTriedBackends())
+	if h.sticky != nil {
+		ctx = withPinnedBackend(ctx, h.pinnedBackend(r))
+	}
 	r = r.WithContext(ctx)
 
 	// ограничиваем количество одновременных запросов
@@ -263,6 +461,18 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// тело читается до отправки запроса, чтобы его можно было повторить
+	body, err := h.prepareBody(r)
+	if err != nil {
+		writeBodyError(w, requestID, err)
+		return
+	}
+	defer body.close()
+	r = r.WithContext(context.WithValue(r.Context(), requestBodyKey, body))
+	if !body.replayable {
+		log.Printf("[BODY][%s] Request body exceeds replay buffer, streaming without retries", requestID)
+	}
+
 	// оборачиваем ResponseWriter для отслеживания записи заголовков
 	wrappedWriter := &responseWriterWrapper{
 		ResponseWriter: w,
@@ -270,5 +480,16 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		proxyHandler:   h,
 	}
 
+	// копия в теневой пул уходит параллельно и не задерживает ответ клиенту
+	if primary := h.startMirror(r, body); primary != nil {
+		defer func() {
+			primary <- mirrorResult{statusCode: wrappedWriter.statusCode, latency: time.Since(startTime)}
+		}()
+	}
+
 	h.proxy.ServeHTTP(wrappedWriter, r)
+
+	if upgrade && wrappedWriter.statusCode == http.StatusSwitchingProtocols {
+		log.Printf("[UPGRADE][%s] Upgraded connection closed after %v", requestID, time.Since(startTime))
+	}
 }
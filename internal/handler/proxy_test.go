@@ -1,13 +1,31 @@
 package handler
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
 )
 
 type mockBalancer struct {
@@ -35,6 +53,10 @@ func (m *mockBalancer) GetBackends() []*url.URL {
 	return m.backends
 }
 
+func (m *mockBalancer) RequestStarted(backend *url.URL) {}
+
+func (m *mockBalancer) RequestFinished(backend *url.URL) {}
+
 type mockRateLimiter struct {
 	allowed bool
 }
@@ -231,6 +253,211 @@ func TestProxyHandler_Retry(t *testing.T) {
 	}
 }
 
+func TestProxyHandler_NoRetryForPost(t *testing.T) {
+	var hits atomic.Int32
+	backend1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	backend2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer func() {
+		backend1.Close()
+		backend2.Close()
+	}()
+
+	backend1URL, _ := url.Parse(backend1.URL)
+	backend2URL, _ := url.Parse(backend2.URL)
+
+	balancer := newMockBalancer([]*url.URL{backend1URL, backend2URL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+
+	req := httptest.NewRequest("POST", "/test", bytes.NewBufferString("test body"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	// неидемпотентный запрос не повторяется, клиент получает ответ бэкенда
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("Expected 1 request to reach backends, got %d", got)
+	}
+}
+
+// filteredBalancer пропускает только бэкенды из available
+type filteredBalancer struct {
+	*mockBalancer
+	available map[string]bool
+}
+
+func (b *filteredBalancer) Next() *url.URL {
+	for range b.backends {
+		if backend := b.mockBalancer.Next(); b.IsAvailable(backend) {
+			return backend
+		}
+	}
+	return nil
+}
+
+func (b *filteredBalancer) IsAvailable(backend *url.URL) bool {
+	return b.available[backend.String()]
+}
+
+func TestProxyHandler_RetrySkipsUnavailable(t *testing.T) {
+	var failingHits, drainedHits atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failingHits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	drained := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		drainedHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer func() {
+		failing.Close()
+		drained.Close()
+	}()
+
+	failingURL, _ := url.Parse(failing.URL)
+	drainedURL, _ := url.Parse(drained.URL)
+
+	// выведенный из работы бэкенд остается в пуле, но недоступен для новых запросов
+	balancer := &filteredBalancer{
+		mockBalancer: newMockBalancer([]*url.URL{failingURL, drainedURL}),
+		available:    map[string]bool{failingURL.String(): true},
+	}
+
+	handler := NewProxyHandler(balancer, newMockRateLimiter(true), newMockClientIdentifier("test-client"), 100)
+
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+		}
+	}
+	if got := drainedHits.Load(); got != 0 {
+		t.Errorf("Expected no retries to reach unavailable backend, got %d", got)
+	}
+	if got := failingHits.Load(); got != 5 {
+		t.Errorf("Expected 5 requests to reach available backend, got %d", got)
+	}
+}
+
+func TestProxyHandler_NoAvailableBackend(t *testing.T) {
+	backendURL, _ := url.Parse("http://backend")
+	balancer := &filteredBalancer{
+		mockBalancer: newMockBalancer([]*url.URL{backendURL}),
+		available:    map[string]bool{},
+	}
+
+	handler := NewProxyHandler(balancer, newMockRateLimiter(true), newMockClientIdentifier("test-client"), 100)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+// drainedFilter выводит из работы перечисленные бэкенды
+type drainedFilter map[string]bool
+
+func (f drainedFilter) IsAvailable(backend *url.URL) bool {
+	return !f[backend.String()]
+}
+
+func TestProxyHandler_NoAvailableBackendRealBalancers(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+	balancers := map[string]interface {
+		service.Balancer
+		AddRequiredFilter(filter service.BackendFilter)
+	}{
+		"round_robin":     service.NewRoundRobinBalancer([]*url.URL{backendURL}),
+		"weighted":        service.NewWeightedRoundRobinBalancer([]service.WeightedBackend{{URL: backendURL, Weight: 1}}),
+		"least_conn":      service.NewLeastConnectionsBalancer([]*url.URL{backendURL}),
+		"power_of_two":    service.NewPowerOfTwoChoicesBalancer([]*url.URL{backendURL}),
+		"ewma":            service.NewEWMABalancer([]*url.URL{backendURL}, 0),
+		"consistent_hash": service.NewConsistentHashBalancer([]*url.URL{backendURL}, 0),
+	}
+
+	for name, balancer := range balancers {
+		t.Run(name, func(t *testing.T) {
+			// единственный бэкенд выводится из работы, запасного выбора нет
+			balancer.AddRequiredFilter(drainedFilter{backendURL.String(): true})
+			handler := NewProxyHandler(balancer, newMockRateLimiter(true), newMockClientIdentifier("test-client"), 100)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+			}
+		})
+	}
+	if got := hits.Load(); got != 0 {
+		t.Errorf("Expected no requests to reach drained backend, got %d", got)
+	}
+}
+
+func TestProxyHandler_Hedging(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte("slow"))
+	}))
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer func() {
+		slow.Close()
+		fast.Close()
+	}()
+
+	slowURL, _ := url.Parse(slow.URL)
+	fastURL, _ := url.Parse(fast.URL)
+
+	balancer := newMockBalancer([]*url.URL{slowURL, fastURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.UseHedging(service.NewHedgePolicy(service.HedgeConfig{
+		Enabled: true,
+		Delay:   20 * time.Millisecond,
+	}))
+
+	start := time.Now()
+	req := httptest.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if body := w.Body.String(); body != "fast" {
+		t.Errorf("Expected response from hedged backend, got %q", body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected hedged request to finish quickly, took %v", elapsed)
+	}
+}
+
 func TestProxyHandler_RequestBody(t *testing.T) {
 	backend := setupTestServer(http.StatusOK)
 	defer backend.Close()
@@ -252,3 +479,741 @@ func TestProxyHandler_RequestBody(t *testing.T) {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
 	}
 }
+
+func TestProxyHandler_CircuitBreakerOpens(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+
+	balancer := newMockBalancer([]*url.URL{backendURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	breakers := service.NewCircuitBreakers(service.CircuitBreakerConfig{
+		Enabled:        true,
+		Window:         time.Minute,
+		ErrorThreshold: 0.5,
+		MinRequests:    3,
+		OpenDuration:   time.Minute,
+	})
+	handler.UseCircuitBreakers(breakers)
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/test", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		// повторять негде, поэтому ответ бэкенда отдается клиенту как есть
+		expected := http.StatusInternalServerError
+		if i >= 3 {
+			expected = http.StatusBadGateway
+		}
+		if w.Code != expected {
+			t.Errorf("Expected status code %d, got %d", expected, w.Code)
+		}
+	}
+
+	// после размыкания выключателя запросы не должны доходить до бэкенда
+	if got := hits.Load(); got != 3 {
+		t.Errorf("Expected 3 requests to reach backend, got %d", got)
+	}
+}
+
+func TestProxyHandler_StickySession(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	backend1 := newBackend("backend1")
+	backend2 := newBackend("backend2")
+	defer func() {
+		backend1.Close()
+		backend2.Close()
+	}()
+
+	backend1URL, _ := url.Parse(backend1.URL)
+	backend2URL, _ := url.Parse(backend2.URL)
+
+	balancer := newMockBalancer([]*url.URL{backend1URL, backend2URL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.UseStickySessions(service.NewStickySessions(service.StickySessionConfig{
+		Enabled: true,
+		Secret:  "test-secret",
+	}), service.DefaultPool)
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected affinity cookie, got %d cookies", len(cookies))
+	}
+	first := w.Body.String()
+
+	// без cookie балансировщик отправил бы эти запросы на другой бэкенд
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Body.String() != first {
+			t.Errorf("Expected response from %s, got %s", first, w.Body.String())
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Errorf("Expected no new cookie for pinned backend")
+		}
+	}
+}
+
+func TestProxyHandler_StickySessionPerPool(t *testing.T) {
+	newBackend := func(name string) *url.URL {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(backend.Close)
+		backendURL, _ := url.Parse(backend.URL)
+		return backendURL
+	}
+
+	sticky := service.NewStickySessions(service.StickySessionConfig{Enabled: true, Secret: "test-secret"})
+	newPoolHandler := func(pool string) *ProxyHandler {
+		balancer := newMockBalancer([]*url.URL{newBackend(pool + "-1"), newBackend(pool + "-2")})
+		handler := NewProxyHandler(balancer, newMockRateLimiter(true), newMockClientIdentifier("test-client"), 100)
+		handler.UseStickySessions(sticky, pool)
+		return handler
+	}
+	api := newPoolHandler("api")
+	web := newPoolHandler("web")
+
+	// клиент хранит cookie обоих пулов, как браузер
+	jar := map[string]*http.Cookie{}
+	send := func(handler *ProxyHandler) string {
+		req := httptest.NewRequest("GET", "/test", nil)
+		for _, cookie := range jar {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		for _, cookie := range w.Result().Cookies() {
+			jar[cookie.Name] = cookie
+		}
+		return w.Body.String()
+	}
+
+	firstAPI := send(api)
+	firstWeb := send(web)
+	if len(jar) != 2 {
+		t.Fatalf("Expected separate cookies for each pool, got %d", len(jar))
+	}
+
+	// переход между маршрутами не сбрасывает привязку ни в одном из пулов
+	for i := 0; i < 3; i++ {
+		if got := send(api); got != firstAPI {
+			t.Errorf("Expected response from %s, got %s", firstAPI, got)
+		}
+		if got := send(web); got != firstWeb {
+			t.Errorf("Expected response from %s, got %s", firstWeb, got)
+		}
+	}
+
+	// cookie одного пула не принимается другим
+	value := jar[sticky.CookieName("api")].Value
+	if _, ok := sticky.Decode("web", value, api.balancer.GetBackends()); ok {
+		t.Error("Expected cookie of another pool to be rejected")
+	}
+}
+
+func TestProxyHandler_RequestBodyTooLarge(t *testing.T) {
+	backend := setupTestServer(http.StatusOK)
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+
+	balancer := newMockBalancer([]*url.URL{backendURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.SetRequestBodyLimits(service.RequestBodyConfig{MaxSize: 8})
+
+	req := httptest.NewRequest("POST", "/test", bytes.NewBufferString("this body is too large"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestProxyHandler_ChunkedBodyTooLarge(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+
+	tests := []struct {
+		name   string
+		config service.RequestBodyConfig
+	}{
+		{"in memory", service.RequestBodyConfig{MaxSize: 16, ReplayBufferSize: 64}},
+		{"spilled to disk", service.RequestBodyConfig{MaxSize: 16, ReplayBufferSize: 4, SpillToDisk: true}},
+		{"streamed", service.RequestBodyConfig{MaxSize: 16, ReplayBufferSize: 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spillDir := t.TempDir()
+			tt.config.SpillDir = spillDir
+
+			handler := NewProxyHandler(newMockBalancer([]*url.URL{backendURL}), newMockRateLimiter(true), newMockClientIdentifier("test-client"), 100)
+			handler.SetRequestBodyLimits(tt.config)
+
+			// длина тела заранее неизвестна, лимит превышается в середине чтения
+			req := httptest.NewRequest("POST", "/test", io.MultiReader(
+				strings.NewReader("first chunk, "),
+				strings.NewReader("second chunk over the limit"),
+			))
+			req.ContentLength = -1
+			req.TransferEncoding = []string{"chunked"}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+			}
+
+			// временный файл с частью тела удаляется и после отказа
+			if entries, _ := os.ReadDir(spillDir); len(entries) != 0 {
+				t.Errorf("Expected temp files to be removed, found %d", len(entries))
+			}
+		})
+	}
+}
+
+// setupEchoServers поднимает бэкенд, отвечающий 500, и бэкенд, возвращающий тело запроса
+func setupEchoServers(t *testing.T) (*mockBalancer, *atomic.Int32) {
+	var hits atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(func() {
+		failing.Close()
+		echo.Close()
+	})
+
+	failingURL, _ := url.Parse(failing.URL)
+	echoURL, _ := url.Parse(echo.URL)
+	return newMockBalancer([]*url.URL{failingURL, echoURL}), &hits
+}
+
+func TestProxyHandler_StreamedBodyNotRetried(t *testing.T) {
+	balancer, hits := setupEchoServers(t)
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.SetRequestBodyLimits(service.RequestBodyConfig{ReplayBufferSize: 4})
+
+	req := httptest.NewRequest("PUT", "/test", bytes.NewBufferString("body larger than buffer"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	// тело больше буфера передается потоком, поэтому запрос не повторяется
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("Expected 1 request to reach backends, got %d", got)
+	}
+}
+
+func TestProxyHandler_SpilledBodyRetried(t *testing.T) {
+	balancer, _ := setupEchoServers(t)
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	spillDir := t.TempDir()
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.SetRequestBodyLimits(service.RequestBodyConfig{
+		ReplayBufferSize: 4,
+		SpillToDisk:      true,
+		SpillDir:         spillDir,
+	})
+
+	body := "body larger than buffer"
+	req := httptest.NewRequest("PUT", "/test", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Body.String(); got != body {
+		t.Errorf("Expected retried body %q, got %q", body, got)
+	}
+
+	// временный файл удаляется после завершения запроса
+	if entries, _ := os.ReadDir(spillDir); len(entries) != 0 {
+		t.Errorf("Expected temp files to be removed, found %d", len(entries))
+	}
+}
+
+func TestProxyHandler_Mirror(t *testing.T) {
+	backend := setupTestServer(http.StatusOK)
+	defer backend.Close()
+
+	var shadowBody, shadowHeader atomic.Value
+	shadowBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		shadowBody.Store(string(body))
+		shadowHeader.Store(r.Header.Clone())
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadowBackend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+	shadowURL, _ := url.Parse(shadowBackend.URL)
+
+	shadow, err := service.NewPool(service.PoolConfig{
+		Name:     "shadow",
+		Backends: []service.WeightedBackend{{URL: shadowURL, Weight: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := service.NewMirror(service.MirrorConfig{Pool: "shadow", Percent: 100}, shadow)
+
+	balancer := newMockBalancer([]*url.URL{backendURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.UseMirror(mirror)
+
+	req := httptest.NewRequest("POST", "/test", bytes.NewBufferString("mirrored body"))
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("Proxy-Authorization", "Basic c2VjcmV0")
+	req.Header.Set("X-Trace", "abc")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	// ответ теневого пула не влияет на ответ клиенту
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mirror.Stats().Mirrored == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := mirror.Stats()
+	if stats.Mirrored != 1 || stats.StatusDiffers != 1 {
+		t.Errorf("Unexpected mirror stats: %+v", stats)
+	}
+	if got, _ := shadowBody.Load().(string); got != "mirrored body" {
+		t.Errorf("Expected shadow to receive request body, got %q", got)
+	}
+
+	// hop-by-hop заголовки в теневой пул не передаются
+	header, _ := shadowHeader.Load().(http.Header)
+	for _, name := range []string{"X-Hop", "Proxy-Authorization"} {
+		if header.Get(name) != "" {
+			t.Errorf("Expected hop-by-hop header %s to be stripped", name)
+		}
+	}
+	if header.Get("X-Trace") != "abc" {
+		t.Errorf("Expected end-to-end header to be mirrored, got %v", header)
+	}
+}
+
+func TestProxyHandler_MirrorUsesShadowProtocol(t *testing.T) {
+	backend := setupTestServer(http.StatusOK)
+	defer backend.Close()
+
+	// теневой бэкенд принимает только h2c
+	h2cOnly := new(http.Protocols)
+	h2cOnly.SetUnencryptedHTTP2(true)
+	var shadowProto atomic.Int32
+	shadowBackend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shadowProto.Store(int32(r.ProtoMajor))
+		w.WriteHeader(http.StatusOK)
+	}))
+	shadowBackend.Config.Protocols = h2cOnly
+	shadowBackend.Start()
+	defer shadowBackend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+	shadowURL, _ := url.Parse(shadowBackend.URL)
+
+	shadow, err := service.NewPool(service.PoolConfig{
+		Name:     "shadow",
+		Backends: []service.WeightedBackend{{URL: shadowURL, Weight: 1}},
+		Protocol: service.ProtocolH2C,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := service.NewMirror(service.MirrorConfig{Pool: "shadow", Percent: 100}, shadow)
+
+	handler := NewProxyHandler(newMockBalancer([]*url.URL{backendURL}), newMockRateLimiter(true), newMockClientIdentifier("test-client"), 100)
+	handler.UseMirror(mirror)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/test", bytes.NewBufferString("mirrored body")))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mirror.Stats().Mirrored == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats := mirror.Stats(); stats.Mirrored != 1 || stats.Failed != 0 {
+		t.Errorf("Unexpected mirror stats: %+v", stats)
+	}
+	if got := shadowProto.Load(); got != 2 {
+		t.Errorf("Expected shadow request over HTTP/2, got HTTP/%d", got)
+	}
+}
+
+func TestProxyHandler_Canary(t *testing.T) {
+	primary := setupTestServer(http.StatusOK)
+	defer primary.Close()
+
+	var canaryHits atomic.Int32
+	canaryHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		canaryHits.Add(1)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	primaryURL, _ := url.Parse(primary.URL)
+
+	balancer := newMockBalancer([]*url.URL{primaryURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	canary, _ := service.NewCanary(service.CanaryConfig{Pool: "canary", Header: "X-Canary"})
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.UseCanary(canary, func(pool string) http.Handler {
+		if pool == "canary" {
+			return canaryHandler
+		}
+		return nil
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || canaryHits.Load() != 0 {
+		t.Errorf("Expected request to be served by primary pool, got status %d", w.Code)
+	}
+
+	// процент меняется во время работы
+	canary.Update(service.CanaryConfig{Pool: "canary", Percent: 100})
+	req = httptest.NewRequest("GET", "/test", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted || canaryHits.Load() != 1 {
+		t.Errorf("Expected request to be served by canary pool, got status %d", w.Code)
+	}
+}
+
+// setupUpgradeProxy поднимает эхо-бэкенд с переключением протокола и прокси перед ним
+func setupUpgradeProxy(t *testing.T, config service.UpgradeConfig) string {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	t.Cleanup(backend.Close)
+
+	backendURL, _ := url.Parse(backend.URL)
+
+	balancer := newMockBalancer([]*url.URL{backendURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.UseUpgradeTracker(service.NewUpgradeTracker(config))
+
+	proxy := httptest.NewServer(handler)
+	t.Cleanup(proxy.Close)
+	return proxy.Listener.Addr().String()
+}
+
+// dialUpgrade открывает соединение через прокси и возвращает код ответа на запрос переключения
+func dialUpgrade(t *testing.T, addr string) (net.Conn, *bufio.Reader, int) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: proxy\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, resp.StatusCode
+}
+
+func TestProxyHandler_WebSocketUpgrade(t *testing.T) {
+	addr := setupUpgradeProxy(t, service.UpgradeConfig{MaxPerClient: 1})
+
+	conn, reader, code := dialUpgrade(t, addr)
+	if code != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status code %d, got %d", http.StatusSwitchingProtocols, code)
+	}
+
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(reader, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("Expected echo through upgraded connection, got %q, %v", buf, err)
+	}
+
+	// второе соединение того же клиента превышает лимит
+	if _, _, code := dialUpgrade(t, addr); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, code)
+	}
+}
+
+func TestProxyHandler_WebSocketIdleTimeout(t *testing.T) {
+	addr := setupUpgradeProxy(t, service.UpgradeConfig{IdleTimeout: 100 * time.Millisecond})
+
+	conn, reader, code := dialUpgrade(t, addr)
+	if code != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status code %d, got %d", http.StatusSwitchingProtocols, code)
+	}
+
+	// простаивающее соединение закрывается прокси
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := reader.ReadByte(); err == nil {
+		t.Error("Expected idle connection to be closed")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Error("Expected proxy to close idle connection before client deadline")
+	}
+}
+
+func TestProxyHandler_EventStreamFlush(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("data: second\n\n"))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	backendURL, _ := url.Parse(backend.URL)
+
+	balancer := newMockBalancer([]*url.URL{backendURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// первое событие должно прийти до завершения ответа бэкенда
+	line := make(chan string, 1)
+	go func() {
+		l, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- l
+	}()
+	select {
+	case l := <-line:
+		if l != "data: first\n" {
+			t.Errorf("Expected first event, got %q", l)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected event to be flushed to client immediately")
+	}
+}
+
+func TestProxyHandler_StreamingRouteIgnoresTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			w.Write([]byte("chunk\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+
+	balancer := newMockBalancer([]*url.URL{backendURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.SetTimeout(50 * time.Millisecond)
+	handler.UseStreaming(service.StreamingConfig{Enabled: true})
+
+	req := httptest.NewRequest("GET", "/stream", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Body.String(); got != "chunk\nchunk\nchunk\n" {
+		t.Errorf("Expected full stream despite pool timeout, got %q", got)
+	}
+
+	// long-poll бэкенд может долго не отправлять заголовки
+	if got := handler.transport.ResponseHeaderTimeout; got != 0 {
+		t.Errorf("Expected no response header timeout on streaming route, got %v", got)
+	}
+}
+
+func TestProxyHandler_H2C(t *testing.T) {
+	h2cOnly := new(http.Protocols)
+	h2cOnly.SetUnencryptedHTTP2(true)
+
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	backend.Config.Protocols = h2cOnly
+	backend.Start()
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+
+	balancer := newMockBalancer([]*url.URL{backendURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.SetUpstreamProtocol(service.ProtocolH2C)
+
+	// прокси тоже принимает h2c, как при включенном listener.h2c
+	proxy := httptest.NewUnstartedServer(handler)
+	proxy.Config.Protocols = new(http.Protocols)
+	proxy.Config.Protocols.SetHTTP1(true)
+	proxy.Config.Protocols.SetUnencryptedHTTP2(true)
+	proxy.Start()
+	defer proxy.Close()
+
+	client := &http.Client{Transport: &http.Transport{Protocols: h2cOnly}}
+	resp, err := client.Get(proxy.URL + "/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2 from proxy, got %s", resp.Proto)
+	}
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("Expected backend to be reached over HTTP/2, got %q", body)
+	}
+}
+
+// writeClientCertificate создает самоподписанный клиентский сертификат и возвращает пути к файлам
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "proxy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestProxyHandler_UpstreamMutualTLS(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	backend.StartTLS()
+	defer backend.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw}), 0o600)
+	certFile, keyFile := writeClientCertificate(t, dir)
+
+	tlsConfig, err := service.NewUpstreamTLS(service.UpstreamTLSConfig{
+		CAFile:     caFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backendURL, _ := url.Parse(backend.URL)
+
+	balancer := newMockBalancer([]*url.URL{backendURL})
+	rateLimiter := newMockRateLimiter(true)
+	clientIdentifier := newMockClientIdentifier("test-client")
+
+	handler := NewProxyHandler(balancer, rateLimiter, clientIdentifier, 100)
+	handler.SetUpstreamTLS(tlsConfig)
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Body.String(); got != "proxy" {
+		t.Errorf("Expected backend to see proxy client certificate, got %q", got)
+	}
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// triedBackends хранит бэкенды, на которые уже отправлялся запрос,
+// чтобы повторная попытка не ушла на тот же бэкенд
+type triedBackends struct {
+	backends map[string]bool
+	mu       sync.Mutex
+}
+
+func newTriedBackends() *triedBackends {
+	return &triedBackends{backends: make(map[string]bool)}
+}
+
+func (t *triedBackends) add(backend *url.URL) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.backends[backend.String()] = true
+}
+
+func (t *triedBackends) contains(backend *url.URL) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.backends[backend.String()]
+}
+
+// SetRetryPolicy задает политику повторных попыток
+func (h *ProxyHandler) SetRetryPolicy(policy *service.RetryPolicy) {
+	h.retryPolicy = policy
+}
+
+// UseRetryBudget ограничивает повторы общим бюджетом, разделяемым между обработчиками
+func (h *ProxyHandler) UseRetryBudget(budget *service.RetryBudget) {
+	h.retryBudget = budget
+}
+
+// maxAttempts возвращает общее число попыток с учетом текущего состава пула
+func (h *ProxyHandler) maxAttempts() int {
+	return h.retryPolicy.MaxAttempts(len(h.balancer.GetBackends()))
+}
+
+// nextUntried выбирает для повторной попытки случайный доступный бэкенд, на который запрос
+// еще не отправлялся. Курсор балансировщика не сдвигается, поэтому вызов можно использовать
+// как проверку. Возвращает nil, если подходящих бэкендов не осталось
+func (h *ProxyHandler) nextUntried(tried *triedBackends) *url.URL {
+	filter, _ := h.balancer.(service.BackendFilter)
+
+	var candidates []*url.URL
+	for _, backend := range h.balancer.GetBackends() {
+		if tried.contains(backend) || (filter != nil && !filter.IsAvailable(backend)) {
+			continue
+		}
+		candidates = append(candidates, backend)
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[rand.IntN(len(candidates))]
+}
+
+// canRetry решает, нужна ли еще одна попытка после ответа с кодом statusCode
+// или ошибки соединения err
+func (h *ProxyHandler) canRetry(r *http.Request, statusCode int, err error) bool {
+	ctx := r.Context()
+	if ctx.Err() != nil {
+		return false
+	}
+
+	// тело, переданное потоком, повторно отправить нельзя
+	if body, ok := ctx.Value(requestBodyKey).(*requestBody); ok && !body.replayable {
+		return false
+	}
+
+	retries, _ := ctx.Value(retriesKey).(int)
+	if retries+1 >= h.maxAttempts() {
+		return false
+	}
+
+	if tried, ok := ctx.Value(triedKey).(*triedBackends); ok && h.nextUntried(tried) == nil {
+		return false
+	}
+
+	if !h.retryPolicy.ShouldRetry(r.Method, statusCode, err) {
+		return false
+	}
+
+	// бюджет расходуется последним, чтобы учитывать только действительно нужные повторы
+	if h.retryBudget != nil && !h.retryBudget.TryRetry() {
+		requestID, _ := ctx.Value(requestIDKey).(string)
+		log.Printf("[RETRY BUDGET][%s] Retry budget exhausted, returning failure without retry", requestID)
+		return false
+	}
+	return true
+}
+
+// waitBackoff выдерживает паузу перед повтором, возвращает false, если запрос уже отменен
+func (h *ProxyHandler) waitBackoff(ctx context.Context, attempt int) bool {
+	backoff := h.retryPolicy.Backoff(attempt)
+	if backoff <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// statusCodeOf возвращает код ответа бэкенда, если ошибка вызвана ответом 5xx
+func statusCodeOf(err error) int {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode
+	}
+	return 0
+}
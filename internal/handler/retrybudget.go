@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type RetryBudgetHandler struct {
+	retryBudget *service.RetryBudget
+}
+
+func NewRetryBudgetHandler(retryBudget *service.RetryBudget) *RetryBudgetHandler {
+	return &RetryBudgetHandler{
+		retryBudget: retryBudget,
+	}
+}
+
+func (h *RetryBudgetHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/api/retry-budget", h.GetRetryBudget).Methods("GET")
+}
+
+// GetRetryBudget возвращает состояние бюджета повторов и число отклоненных повторов
+func (h *RetryBudgetHandler) GetRetryBudget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.retryBudget.Stats())
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// UseStickySessions включает закрепление клиентов за бэкендами пула через cookie
+func (h *ProxyHandler) UseStickySessions(sticky *service.StickySessions, pool string) {
+	if sticky.Enabled() {
+		h.sticky = sticky
+		h.stickyPool = pool
+	}
+}
+
+// pinnedBackend возвращает бэкенд из cookie привязки, если он еще есть в пуле и доступен
+func (h *ProxyHandler) pinnedBackend(r *http.Request) *url.URL {
+	cookie, err := r.Cookie(h.sticky.CookieName(h.stickyPool))
+	if err != nil {
+		return nil
+	}
+
+	backend, ok := h.sticky.Decode(h.stickyPool, cookie.Value, h.balancer.GetBackends())
+	if !ok {
+		return nil
+	}
+
+	if filter, ok := h.balancer.(service.BackendFilter); ok && !filter.IsAvailable(backend) {
+		return nil
+	}
+	return backend
+}
+
+// setAffinityCookie закрепляет клиента за бэкендом, который ответил на запрос
+func (h *ProxyHandler) setAffinityCookie(resp *http.Response, backend *url.URL) {
+	if h.sticky == nil || backend == nil {
+		return
+	}
+
+	if pinned, _ := resp.Request.Context().Value(stickyBackendKey).(*url.URL); pinned == backend {
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     h.sticky.CookieName(h.stickyPool),
+		Value:    h.sticky.Encode(h.stickyPool, backend),
+		Path:     "/",
+		MaxAge:   int(h.sticky.TTL().Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	resp.Header.Add("Set-Cookie", cookie.String())
+}
+
+func withPinnedBackend(ctx context.Context, backend *url.URL) context.Context {
+	if backend == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, stickyBackendKey, backend)
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// UseStreaming настраивает обработчик для маршрута с потоковыми ответами:
+// ответ сбрасывается клиенту без буферизации, а таймаут пула заменяется ограничением длительности потока.
+// Ответы text/event-stream сбрасываются сразу и без этой настройки
+func (h *ProxyHandler) UseStreaming(config service.StreamingConfig) {
+	h.streaming = &config
+
+	h.proxy.FlushInterval = -1
+	if config.FlushInterval > 0 {
+		h.proxy.FlushInterval = config.FlushInterval
+	}
+
+	// у обработчика маршрута свой транспорт, поэтому ожидание заголовков меняется только для него.
+	// Long-poll и SSE-бэкенды могут долго не отвечать, и это не должно считаться ошибкой для повтора
+	h.transport.ResponseHeaderTimeout = config.HeaderTimeout
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// circuitBreakerTransport не пропускает запросы к бэкендам с разомкнутым выключателем
+// и сообщает выключателю результат каждого запроса
+type circuitBreakerTransport struct {
+	next     http.RoundTripper
+	breakers *service.CircuitBreakers
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backend, _ := req.Context().Value(currentBackendKey).(*url.URL)
+	if backend == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	if err := t.breakers.Allow(backend); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil && errors.Is(err, context.Canceled):
+		t.breakers.Release(backend)
+	case err != nil:
+		t.breakers.Record(backend, false)
+	default:
+		t.breakers.Record(backend, resp.StatusCode < 500)
+	}
+	return resp, err
+}
+
+// UseCircuitBreakers оборачивает транспорт прокси в автоматические выключатели бэкендов
+func (h *ProxyHandler) UseCircuitBreakers(breakers *service.CircuitBreakers) {
+	h.proxy.Transport = &circuitBreakerTransport{
+		next:     h.proxy.Transport,
+		breakers: breakers,
+	}
+}
+
+// SetUpstreamProtocol задает протокол обращения к бэкендам пула
+func (h *ProxyHandler) SetUpstreamProtocol(protocol string) {
+	h.transport.Protocols = service.UpstreamProtocols(protocol)
+}
+
+// SetUpstreamTLS задает TLS-настройки соединений с бэкендами пула
+func (h *ProxyHandler) SetUpstreamTLS(config *tls.Config) {
+	h.transport.TLSClientConfig = config
+}
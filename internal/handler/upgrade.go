@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/service"
+)
+
+// UseUpgradeTracker включает ограничения для WebSocket и других Upgrade-соединений
+func (h *ProxyHandler) UseUpgradeTracker(tracker *service.UpgradeTracker) {
+	h.upgrades = tracker
+}
+
+// isUpgradeRequest проверяет, просит ли клиент переключить протокол соединения
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter
+func (w *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush отправляет клиенту накопленные данные ответа
+func (w *responseWriterWrapper) Flush() {
+	w.written.Store(true)
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack передает соединение клиента прокси для переключения протокола
+func (w *responseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.written.Store(true)
+	w.statusCode = http.StatusSwitchingProtocols
+
+	if tracker := w.proxyHandler.upgrades; tracker != nil && tracker.Config().IdleTimeout > 0 {
+		conn = &idleConn{Conn: conn, timeout: tracker.Config().IdleTimeout}
+	}
+	return conn, brw, nil
+}
+
+// idleConn закрывает соединение, по которому долго не передавались данные.
+// Через соединение клиента идут данные в обе стороны, поэтому любая активность продлевает срок
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(b)
+}
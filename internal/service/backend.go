@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/entity"
+)
+
+var ErrPoolNotFound = errors.New("pool not found")
+
+// BackendService управляет составом пулов бэкендов во время работы прокси
+type BackendService struct {
+	pools []*Pool
+}
+
+func NewBackendService(pools []*Pool) *BackendService {
+	return &BackendService{
+		pools: pools,
+	}
+}
+
+// pool возвращает пул по имени, пустое имя означает пул по умолчанию
+func (s *BackendService) pool(name string) (*Pool, error) {
+	if name == "" {
+		name = DefaultPool
+	}
+	for _, pool := range s.pools {
+		if pool.Name == name {
+			return pool, nil
+		}
+	}
+	return nil, ErrPoolNotFound
+}
+
+// ListBackends возвращает бэкенды пула или всех пулов, если имя пула не задано
+func (s *BackendService) ListBackends(poolName string) (entity.BackendList, error) {
+	pools := s.pools
+	if poolName != "" {
+		pool, err := s.pool(poolName)
+		if err != nil {
+			return entity.BackendList{}, err
+		}
+		pools = []*Pool{pool}
+	}
+
+	backends := []entity.BackendStatus{}
+	for _, pool := range pools {
+		backends = append(backends, pool.Backends()...)
+	}
+
+	return entity.BackendList{
+		Backends: backends,
+		Total:    len(backends),
+	}, nil
+}
+
+func (s *BackendService) AddBackend(req *entity.AddBackendRequest) error {
+	pool, err := s.pool(req.Pool)
+	if err != nil {
+		return err
+	}
+	return pool.AddBackend(req.URL, req.Weight)
+}
+
+func (s *BackendService) RemoveBackend(poolName, rawURL string) error {
+	pool, err := s.pool(poolName)
+	if err != nil {
+		return err
+	}
+	return pool.RemoveBackend(rawURL)
+}
+
+func (s *BackendService) SetDraining(poolName, rawURL string, draining bool) error {
+	pool, err := s.pool(poolName)
+	if err != nil {
+		return err
+	}
+	return pool.SetDraining(rawURL, draining)
+}
+
+// ListCanaries возвращает настройки разделения трафика всех пулов с канареечным пулом
+func (s *BackendService) ListCanaries() entity.CanaryList {
+	canaries := []entity.CanaryStatus{}
+	for _, pool := range s.pools {
+		config := pool.Canary.Config()
+		if config.Pool == "" {
+			continue
+		}
+		canaries = append(canaries, entity.CanaryStatus{
+			Pool:        pool.Name,
+			CanaryPool:  config.Pool,
+			Percent:     config.Percent,
+			Header:      config.Header,
+			HeaderValue: config.HeaderValue,
+			Cookie:      config.Cookie,
+			CookieValue: config.CookieValue,
+			Consistent:  config.Consistent,
+		})
+	}
+
+	return entity.CanaryList{
+		Canaries: canaries,
+		Total:    len(canaries),
+	}
+}
+
+// UpdateCanary меняет разделение трафика пула во время работы
+func (s *BackendService) UpdateCanary(req *entity.UpdateCanaryRequest) error {
+	pool, err := s.pool(req.Pool)
+	if err != nil {
+		return err
+	}
+	if req.CanaryPool != "" {
+		canaryPool, err := s.pool(req.CanaryPool)
+		if err != nil {
+			return err
+		}
+		if canaryPool == pool {
+			return ErrInvalidCanary
+		}
+	}
+
+	return pool.Canary.Update(CanaryConfig{
+		Pool:        req.CanaryPool,
+		Percent:     req.Percent,
+		Header:      req.Header,
+		HeaderValue: req.HeaderValue,
+		Cookie:      req.Cookie,
+		CookieValue: req.CookieValue,
+		Consistent:  req.Consistent,
+	})
+}
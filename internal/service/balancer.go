@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	StrategyRoundRobin         = "round_robin"
+	StrategyWeightedRoundRobin = "weighted_round_robin"
+	StrategyLeastConnections   = "least_connections"
+	StrategyPowerOfTwoChoices  = "power_of_two_choices"
+	StrategyEWMA               = "ewma"
+	StrategyConsistentHash     = "consistent_hash"
+)
+
+// BalancerConfig содержит настройки балансировщика
+type BalancerConfig struct {
+	Strategy     string
+	EWMAAlpha    float64 // вес нового замера времени ответа для стратегии ewma
+	VirtualNodes int     // число виртуальных узлов бэкенда для стратегии consistent_hash
+}
+
+// WeightedBackend описывает бэкенд вместе с его весом
+type WeightedBackend struct {
+	URL    *url.URL
+	Weight int
+}
+
+// managedBalancer - балансировщик пула: умеет пропускать недоступные бэкенды
+// и менять состав бэкендов во время работы
+type managedBalancer interface {
+	Balancer
+	BackendFilter
+	AddFilter(filter BackendFilter)
+	AddSelectionFilter(filter BackendFilter)
+	AddRequiredFilter(filter BackendFilter)
+	AddBackend(backend *url.URL, weight int)
+	RemoveBackend(backend *url.URL) bool
+	InFlight(backend *url.URL) int64
+}
+
+// newBalancer создает балансировщик по названию стратегии из конфигурации
+func newBalancer(config BalancerConfig, backends []WeightedBackend) (managedBalancer, error) {
+	switch config.Strategy {
+	case "", StrategyRoundRobin:
+		return NewRoundRobinBalancer(backendURLs(backends)), nil
+	case StrategyWeightedRoundRobin:
+		return NewWeightedRoundRobinBalancer(backends), nil
+	case StrategyLeastConnections:
+		return NewLeastConnectionsBalancer(backendURLs(backends)), nil
+	case StrategyPowerOfTwoChoices:
+		return NewPowerOfTwoChoicesBalancer(backendURLs(backends)), nil
+	case StrategyEWMA:
+		return NewEWMABalancer(backendURLs(backends), config.EWMAAlpha), nil
+	case StrategyConsistentHash:
+		return NewConsistentHashBalancer(backendURLs(backends), config.VirtualNodes), nil
+	default:
+		return nil, fmt.Errorf("unknown balancer strategy: %q", config.Strategy)
+	}
+}
+
+func backendURLs(backends []WeightedBackend) []*url.URL {
+	urls := make([]*url.URL, len(backends))
+	for i, backend := range backends {
+		urls[i] = backend.URL
+	}
+	return urls
+}
+
+// connTracker считает запросы к бэкендам, которые сейчас в обработке
+type connTracker struct {
+	inFlight sync.Map // URL бэкенда -> *atomic.Int64
+}
+
+func (t *connTracker) counter(backend *url.URL) *atomic.Int64 {
+	if value, ok := t.inFlight.Load(backend.String()); ok {
+		return value.(*atomic.Int64)
+	}
+	value, _ := t.inFlight.LoadOrStore(backend.String(), new(atomic.Int64))
+	return value.(*atomic.Int64)
+}
+
+func (t *connTracker) RequestStarted(backend *url.URL) {
+	if backend != nil {
+		t.counter(backend).Add(1)
+	}
+}
+
+func (t *connTracker) RequestFinished(backend *url.URL) {
+	if backend != nil {
+		t.counter(backend).Add(-1)
+	}
+}
+
+// InFlight возвращает число запросов к бэкенду, которые сейчас в обработке
+func (t *connTracker) InFlight(backend *url.URL) int64 {
+	return t.counter(backend).Load()
+}
+
+// backendList - потокобезопасный список бэкендов для балансировщиков без весов
+type backendList struct {
+	backends []*url.URL
+	mutex    sync.RWMutex
+}
+
+// AddBackend добавляет бэкенд в список, вес не учитывается
+func (l *backendList) AddBackend(backend *url.URL, weight int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.backends = append(l.backends, backend)
+}
+
+func (l *backendList) RemoveBackend(backend *url.URL) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for i, u := range l.backends {
+		if u.String() == backend.String() {
+			l.backends = append(l.backends[:i], l.backends[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *backendList) GetBackends() []*url.URL {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	result := make([]*url.URL, len(l.backends))
+	copy(result, l.backends)
+	return result
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("failed to parse url %s: %v", raw, err)
+	}
+	return u
+}
+
+type staticFilter map[string]bool
+
+func (f staticFilter) IsAvailable(backend *url.URL) bool {
+	available, ok := f[backend.String()]
+	return !ok || available
+}
+
+func TestWeightedRoundRobinBalancer_Distribution(t *testing.T) {
+	a := mustParseURL(t, "http://a")
+	b := mustParseURL(t, "http://b")
+	c := mustParseURL(t, "http://c")
+
+	balancer := NewWeightedRoundRobinBalancer([]WeightedBackend{
+		{URL: a, Weight: 5},
+		{URL: b, Weight: 1},
+		{URL: c, Weight: 1},
+	})
+
+	// плавный алгоритм nginx дает последовательность a a b a c a a
+	expected := []*url.URL{a, a, b, a, c, a, a}
+	for i, want := range expected {
+		if got := balancer.Next(); got != want {
+			t.Errorf("pick %d: expected %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestWeightedRoundRobinBalancer_SkipsUnavailable(t *testing.T) {
+	a := mustParseURL(t, "http://a")
+	b := mustParseURL(t, "http://b")
+
+	balancer := NewWeightedRoundRobinBalancer([]WeightedBackend{
+		{URL: a, Weight: 5},
+		{URL: b, Weight: 1},
+	})
+	balancer.AddFilter(staticFilter{a.String(): false})
+
+	for i := 0; i < 6; i++ {
+		if got := balancer.Next(); got != b {
+			t.Errorf("Expected %s, got %s", b, got)
+		}
+	}
+}
+
+func TestLeastConnectionsBalancer_PrefersIdleBackend(t *testing.T) {
+	a := mustParseURL(t, "http://a")
+	b := mustParseURL(t, "http://b")
+
+	balancer := NewLeastConnectionsBalancer([]*url.URL{a, b})
+
+	balancer.RequestStarted(a)
+	balancer.RequestStarted(a)
+	balancer.RequestStarted(b)
+
+	if got := balancer.Next(); got != b {
+		t.Errorf("Expected %s, got %s", b, got)
+	}
+
+	balancer.RequestFinished(a)
+	balancer.RequestFinished(a)
+	if got := balancer.Next(); got != a {
+		t.Errorf("Expected %s, got %s", a, got)
+	}
+}
+
+func TestPowerOfTwoChoicesBalancer_AvoidsBusyBackend(t *testing.T) {
+	a := mustParseURL(t, "http://a")
+	b := mustParseURL(t, "http://b")
+
+	balancer := NewPowerOfTwoChoicesBalancer([]*url.URL{a, b})
+	balancer.RequestStarted(a)
+
+	// при двух бэкендах оба всегда попадают в выборку
+	for i := 0; i < 10; i++ {
+		if got := balancer.Next(); got != b {
+			t.Errorf("Expected %s, got %s", b, got)
+		}
+	}
+}
+
+func TestEWMABalancer_PrefersFasterBackend(t *testing.T) {
+	fast := mustParseURL(t, "http://fast")
+	slow := mustParseURL(t, "http://slow")
+
+	balancer := NewEWMABalancer([]*url.URL{fast, slow}, 0.5)
+	balancer.ObserveLatency(fast, 10*time.Millisecond)
+	balancer.ObserveLatency(slow, 200*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		if got := balancer.Next(); got != fast {
+			t.Errorf("Expected %s, got %s", fast, got)
+		}
+	}
+
+	// штраф за запросы в обработке уводит трафик с перегруженного быстрого бэкенда
+	for i := 0; i < 30; i++ {
+		balancer.RequestStarted(fast)
+	}
+	if got := balancer.Next(); got != slow {
+		t.Errorf("Expected %s, got %s", slow, got)
+	}
+}
+
+func TestEWMABalancer_UnmeasuredAndFailingBackends(t *testing.T) {
+	measured := mustParseURL(t, "http://measured")
+	fresh := mustParseURL(t, "http://fresh")
+
+	// бэкенд без замеров оценивается средним по пулу, и штраф за запросы в обработке действует
+	balancer := NewEWMABalancer([]*url.URL{measured, fresh}, 0.5)
+	balancer.ObserveLatency(measured, 5*time.Millisecond)
+	balancer.RequestStarted(fresh)
+	for i := 0; i < 10; i++ {
+		if got := balancer.Next(); got != measured {
+			t.Errorf("Expected %s, got %s", measured, got)
+		}
+	}
+
+	// ошибки учитываются со штрафом, и неисправный бэкенд не выглядит быстрым
+	balancer.RequestFinished(fresh)
+	balancer.ObserveFailure(fresh, time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if got := balancer.Next(); got != measured {
+			t.Errorf("Expected %s, got %s", measured, got)
+		}
+	}
+}
+
+func TestConsistentHashBalancer_MinimalRemapping(t *testing.T) {
+	a := mustParseURL(t, "http://a")
+	b := mustParseURL(t, "http://b")
+	c := mustParseURL(t, "http://c")
+
+	balancer := NewConsistentHashBalancer([]*url.URL{a, b, c}, 100)
+
+	keys := make([]string, 1000)
+	before := make(map[string]*url.URL, len(keys))
+	for i := range keys {
+		keys[i] = "client-" + strconv.Itoa(i)
+		before[keys[i]] = balancer.NextForKey(keys[i])
+		if again := balancer.NextForKey(keys[i]); again != before[keys[i]] {
+			t.Fatalf("Key %s moved from %s to %s without ring changes", keys[i], before[keys[i]], again)
+		}
+	}
+
+	// после удаления бэкенда переезжают только ключи, которые были закреплены за ним
+	balancer.RemoveBackend(c)
+	for _, key := range keys {
+		after := balancer.NextForKey(key)
+		if before[key] != c && after != before[key] {
+			t.Errorf("Key %s moved from %s to %s after removing %s", key, before[key], after, c)
+		}
+	}
+}
+
+func TestConsistentHashBalancer_FallsBackToNextNode(t *testing.T) {
+	a := mustParseURL(t, "http://a")
+	b := mustParseURL(t, "http://b")
+
+	balancer := NewConsistentHashBalancer([]*url.URL{a, b}, 50)
+	primary := balancer.NextForKey("client")
+
+	balancer.AddFilter(staticFilter{primary.String(): false})
+	if got := balancer.NextForKey("client"); got == primary {
+		t.Errorf("Expected fallback away from unavailable backend %s", primary)
+	}
+}
+
+func TestBalancers_FallbackSkipsRequiredFilter(t *testing.T) {
+	a := mustParseURL(t, "http://a")
+	b := mustParseURL(t, "http://b")
+	backends := []WeightedBackend{{URL: a, Weight: 5}, {URL: b, Weight: 1}}
+
+	strategies := []string{
+		StrategyRoundRobin,
+		StrategyWeightedRoundRobin,
+		StrategyLeastConnections,
+		StrategyPowerOfTwoChoices,
+		StrategyEWMA,
+		StrategyConsistentHash,
+	}
+	for _, strategy := range strategies {
+		t.Run(strategy, func(t *testing.T) {
+			balancer, err := newBalancer(BalancerConfig{Strategy: strategy}, backends)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// недоступны все бэкенды, но выводимый из работы не выбирается и запасным
+			balancer.AddFilter(staticFilter{"http://a": false, "http://b": false})
+			balancer.AddRequiredFilter(staticFilter{"http://a": false})
+			for i := 0; i < 10; i++ {
+				if got := balancer.Next(); got != b {
+					t.Fatalf("Expected fallback to %s, got %v", b, got)
+				}
+			}
+
+			// если запасного бэкенда нет, балансировщик ничего не выбирает
+			balancer.AddRequiredFilter(staticFilter{"http://b": false})
+			if got := balancer.Next(); got != nil {
+				t.Errorf("Expected no backend, got %s", got)
+			}
+			if keyed, ok := balancer.(*ConsistentHashBalancer); ok {
+				if got := keyed.NextForKey("client"); got != nil {
+					t.Errorf("Expected no backend for key, got %s", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+)
+
+var ErrInvalidCanary = errors.New("invalid canary config")
+
+// CanaryConfig содержит правила отправки части запросов пула в канареечный пул
+type CanaryConfig struct {
+	Pool        string  // канареечный пул, пусто - разделение выключено
+	Percent     float64 // процент запросов (0..100), уходящих в канареечный пул
+	Header      string  // запросы с этим заголовком всегда уходят в канареечный пул
+	HeaderValue string  // значение заголовка, пусто - достаточно наличия заголовка
+	Cookie      string  // запросы с этой cookie всегда уходят в канареечный пул
+	CookieValue string  // значение cookie, пусто - достаточно наличия cookie
+	Consistent  bool    // один и тот же клиент всегда попадает в одну и ту же сторону
+}
+
+// Canary решает, направить ли запрос в канареечный пул. Настройки меняются во время работы
+type Canary struct {
+	config atomic.Pointer[CanaryConfig]
+}
+
+func NewCanary(config CanaryConfig) (*Canary, error) {
+	canary := &Canary{}
+	if err := canary.Update(config); err != nil {
+		return nil, err
+	}
+	return canary, nil
+}
+
+// Update заменяет настройки разделения трафика
+func (c *Canary) Update(config CanaryConfig) error {
+	if config.Percent < 0 || config.Percent > 100 {
+		return ErrInvalidCanary
+	}
+	c.config.Store(&config)
+	return nil
+}
+
+func (c *Canary) Config() CanaryConfig {
+	return *c.config.Load()
+}
+
+// Route возвращает имя канареечного пула, если запрос клиента clientID должен уйти в него
+func (c *Canary) Route(r *http.Request, clientID string) (string, bool) {
+	config := c.config.Load()
+	if config.Pool == "" {
+		return "", false
+	}
+
+	if config.Header != "" {
+		if value := r.Header.Get(config.Header); value != "" &&
+			(config.HeaderValue == "" || value == config.HeaderValue) {
+			return config.Pool, true
+		}
+	}
+	if config.Cookie != "" {
+		if cookie, err := r.Cookie(config.Cookie); err == nil &&
+			(config.CookieValue == "" || cookie.Value == config.CookieValue) {
+			return config.Pool, true
+		}
+	}
+
+	if config.Percent <= 0 {
+		return "", false
+	}
+
+	// при постоянном разделении клиент попадает в сторону по хешу своего ID
+	var point float64
+	if config.Consistent && clientID != "" {
+		h := fnv.New64a()
+		h.Write([]byte(clientID))
+		point = float64(h.Sum64()%10000) / 100
+	} else {
+		point = rand.Float64() * 100
+	}
+
+	if point < config.Percent {
+		return config.Pool, true
+	}
+	return "", false
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanary_Route(t *testing.T) {
+	canary, err := NewCanary(CanaryConfig{
+		Pool:        "canary",
+		Percent:     0,
+		Header:      "X-Canary",
+		HeaderValue: "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, ok := canary.Route(req, "client"); ok {
+		t.Error("Expected request without header to stay in primary pool")
+	}
+
+	req.Header.Set("X-Canary", "true")
+	if pool, ok := canary.Route(req, "client"); !ok || pool != "canary" {
+		t.Errorf("Expected request with header to go to canary pool, got %q", pool)
+	}
+
+	if err := canary.Update(CanaryConfig{Pool: "canary", Percent: 150}); err == nil {
+		t.Error("Expected error for percent above 100")
+	}
+}
+
+func TestCanary_ConsistentSplit(t *testing.T) {
+	canary, _ := NewCanary(CanaryConfig{Pool: "canary", Percent: 30, Consistent: true})
+
+	canaryClients := 0
+	for i := 0; i < 1000; i++ {
+		clientID := fmt.Sprintf("client-%d", i)
+		req := httptest.NewRequest("GET", "/", nil)
+		_, first := canary.Route(req, clientID)
+
+		// клиент не переключается между версиями
+		for j := 0; j < 5; j++ {
+			if _, ok := canary.Route(req, clientID); ok != first {
+				t.Fatalf("Client %s flipped between pools", clientID)
+			}
+		}
+		if first {
+			canaryClients++
+		}
+	}
+
+	if canaryClients < 200 || canaryClients > 400 {
+		t.Errorf("Expected about 30%% of clients in canary pool, got %d of 1000", canaryClients)
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// certificateReloadDelay собирает серию изменений файлов в одну перезагрузку
+const certificateReloadDelay = 500 * time.Millisecond
+
+// CertificatePair описывает сертификат и ключ в файлах
+type CertificatePair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertificateStore хранит сертификаты TLS-порта, выбирает их по SNI
+// и перечитывает файлы при изменении без разрыва установленных соединений
+type CertificateStore struct {
+	pairs        []CertificatePair
+	certificates atomic.Pointer[[]*tls.Certificate]
+	done         chan struct{}
+}
+
+func NewCertificateStore(pairs []CertificatePair) (*CertificateStore, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("no certificates configured")
+	}
+
+	store := &CertificateStore{pairs: pairs}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Reload перечитывает все сертификаты. При ошибке остаются прежние сертификаты
+func (s *CertificateStore) Reload() error {
+	certificates := make([]*tls.Certificate, 0, len(s.pairs))
+	for _, pair := range s.pairs {
+		certificate, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate %s: %w", pair.CertFile, err)
+		}
+		certificates = append(certificates, &certificate)
+	}
+
+	s.certificates.Store(&certificates)
+	return nil
+}
+
+// GetCertificate выбирает сертификат по имени сервера из ClientHello (SNI).
+// Клиент без SNI или с неизвестным именем получает первый сертификат
+func (s *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificates := *s.certificates.Load()
+	for _, certificate := range certificates {
+		if hello.SupportsCertificate(certificate) == nil {
+			return certificate, nil
+		}
+	}
+	return certificates[0], nil
+}
+
+// Start запускает отслеживание изменений файлов сертификатов
+func (s *CertificateStore) Start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// следим за каталогами: при замене файла переименованием наблюдение за самим файлом теряется
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, pair := range s.pairs {
+		for _, file := range []string{pair.CertFile, pair.KeyFile} {
+			path, err := filepath.Abs(file)
+			if err != nil {
+				watcher.Close()
+				return err
+			}
+			files[path] = true
+			dirs[filepath.Dir(path)] = true
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	s.done = make(chan struct{})
+	go s.watch(watcher, files)
+	return nil
+}
+
+func (s *CertificateStore) Stop() {
+	if s.done != nil {
+		close(s.done)
+	}
+}
+
+func (s *CertificateStore) watch(watcher *fsnotify.Watcher, files map[string]bool) {
+	defer watcher.Close()
+
+	timer := time.NewTimer(certificateReloadDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// ..data - символическая ссылка, которую Kubernetes подменяет при обновлении секрета
+			if files[filepath.Clean(event.Name)] || filepath.Base(event.Name) == "..data" {
+				timer.Reset(certificateReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[TLS] Certificate watcher error: %v", err)
+		case <-timer.C:
+			if err := s.Reload(); err != nil {
+				log.Printf("[TLS] Failed to reload certificates, keeping previous ones: %v", err)
+				continue
+			}
+			log.Printf("[TLS] Certificates reloaded")
+		case <-s.done:
+			return
+		}
+	}
+}
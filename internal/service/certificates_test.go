@@ -0,0 +1,114 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate создает самоподписанный сертификат для host и возвращает пару файлов
+func writeCertificate(t *testing.T, dir, name, host string, serial int64) CertificatePair {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair := CertificatePair{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	os.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return pair
+}
+
+func servedSerial(t *testing.T, store *CertificateStore, serverName string) int64 {
+	t.Helper()
+
+	certificate, err := store.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:        serverName,
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SupportedCurves:   []tls.CurveID{tls.CurveP256},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate.Leaf.SerialNumber.Int64()
+}
+
+func TestCertificateStore_SNI(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewCertificateStore([]CertificatePair{
+		writeCertificate(t, dir, "a", "a.example.com", 1),
+		writeCertificate(t, dir, "b", "b.example.com", 2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := servedSerial(t, store, "b.example.com"); got != 2 {
+		t.Errorf("Expected certificate for b.example.com, got serial %d", got)
+	}
+	// неизвестное имя получает первый сертификат
+	if got := servedSerial(t, store, "unknown.example.com"); got != 1 {
+		t.Errorf("Expected default certificate, got serial %d", got)
+	}
+}
+
+func TestCertificateStore_Reload(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewCertificateStore([]CertificatePair{writeCertificate(t, dir, "a", "a.example.com", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Stop()
+
+	writeCertificate(t, dir, "a", "a.example.com", 2)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedSerial(t, store, "a.example.com") != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected certificate to be reloaded after file change")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// битый файл не заменяет рабочий сертификат
+	os.WriteFile(filepath.Join(dir, "a.crt"), []byte("broken"), 0o600)
+	if err := store.Reload(); err == nil {
+		t.Error("Expected error for broken certificate")
+	}
+	if got := servedSerial(t, store, "a.example.com"); got != 2 {
+		t.Errorf("Expected previous certificate to stay, got serial %d", got)
+	}
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/entity"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerConfig содержит настройки автоматических выключателей бэкендов
+type CircuitBreakerConfig struct {
+	Enabled          bool
+	Window           time.Duration // окно, за которое считается доля ошибок
+	ErrorThreshold   float64       // доля ошибок (0..1), при которой выключатель размыкается
+	MinRequests      int           // минимальное число запросов в окне для принятия решения
+	OpenDuration     time.Duration // сколько выключатель остается разомкнутым
+	HalfOpenRequests int           // число пробных запросов в полуоткрытом состоянии
+}
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// windowBucket хранит статистику запросов за одну секунду окна
+type windowBucket struct {
+	second   int64
+	total    int
+	failures int
+}
+
+type circuitBreaker struct {
+	state            string
+	since            time.Time
+	buckets          []windowBucket
+	halfOpenInFlight int
+	halfOpenPassed   int
+}
+
+// CircuitBreakers хранит выключатели для каждого бэкенда
+type CircuitBreakers struct {
+	recoveryNotifier
+	config   CircuitBreakerConfig
+	breakers map[string]*circuitBreaker
+	mu       sync.Mutex
+}
+
+func NewCircuitBreakers(config CircuitBreakerConfig) *CircuitBreakers {
+	if config.Window < time.Second {
+		config.Window = 10 * time.Second
+	}
+	if config.ErrorThreshold <= 0 || config.ErrorThreshold > 1 {
+		config.ErrorThreshold = 0.5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+
+	return &CircuitBreakers{
+		config:   config,
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+func (c *CircuitBreakers) get(key string, now time.Time) *circuitBreaker {
+	breaker, ok := c.breakers[key]
+	if !ok {
+		breaker = &circuitBreaker{
+			state:   CircuitClosed,
+			since:   now,
+			buckets: make([]windowBucket, int(c.config.Window/time.Second)),
+		}
+		c.breakers[key] = breaker
+	}
+	return breaker
+}
+
+// Allow резервирует право отправить запрос на бэкенд.
+// Каждый успешный вызов Allow должен завершаться вызовом Record
+func (c *CircuitBreakers) Allow(backend *url.URL) error {
+	if !c.config.Enabled {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	key := backend.String()
+	breaker := c.get(key, now)
+
+	if breaker.state == CircuitOpen && now.Sub(breaker.since) >= c.config.OpenDuration {
+		c.transition(backend, breaker, CircuitHalfOpen, now)
+	}
+
+	switch breaker.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if breaker.halfOpenInFlight >= c.config.HalfOpenRequests {
+			return ErrCircuitOpen
+		}
+		breaker.halfOpenInFlight++
+	}
+	return nil
+}
+
+// Record учитывает результат запроса, разрешенного через Allow
+func (c *CircuitBreakers) Record(backend *url.URL, success bool) {
+	if !c.config.Enabled {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	key := backend.String()
+	breaker := c.get(key, now)
+
+	switch breaker.state {
+	case CircuitHalfOpen:
+		if breaker.halfOpenInFlight > 0 {
+			breaker.halfOpenInFlight--
+		}
+		if !success {
+			c.transition(backend, breaker, CircuitOpen, now)
+			return
+		}
+		breaker.halfOpenPassed++
+		if breaker.halfOpenPassed >= c.config.HalfOpenRequests {
+			c.transition(backend, breaker, CircuitClosed, now)
+		}
+	case CircuitClosed:
+		bucket := c.bucket(breaker, now)
+		bucket.total++
+		if !success {
+			bucket.failures++
+		}
+
+		total, failures := c.windowStats(breaker, now)
+		if total >= c.config.MinRequests && float64(failures)/float64(total) >= c.config.ErrorThreshold {
+			c.transition(backend, breaker, CircuitOpen, now)
+		}
+	}
+}
+
+// Release освобождает разрешение, полученное через Allow, не учитывая результат запроса.
+// Используется, когда запрос был отменен клиентом
+func (c *CircuitBreakers) Release(backend *url.URL) {
+	if !c.config.Enabled {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	breaker, ok := c.breakers[backend.String()]
+	if ok && breaker.state == CircuitHalfOpen && breaker.halfOpenInFlight > 0 {
+		breaker.halfOpenInFlight--
+	}
+}
+
+// IsAvailable позволяет балансировщику пропускать бэкенды с разомкнутым выключателем
+func (c *CircuitBreakers) IsAvailable(backend *url.URL) bool {
+	if !c.config.Enabled {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	breaker, ok := c.breakers[backend.String()]
+	if !ok {
+		return true
+	}
+
+	switch breaker.state {
+	case CircuitOpen:
+		return time.Since(breaker.since) >= c.config.OpenDuration
+	case CircuitHalfOpen:
+		return breaker.halfOpenInFlight < c.config.HalfOpenRequests
+	}
+	return true
+}
+
+func (c *CircuitBreakers) transition(backend *url.URL, breaker *circuitBreaker, state string, now time.Time) {
+	log.Printf("[CIRCUIT] Backend %s: %s -> %s", backend, breaker.state, state)
+
+	breaker.state = state
+	breaker.since = now
+	breaker.halfOpenInFlight = 0
+	breaker.halfOpenPassed = 0
+	if state == CircuitClosed {
+		for i := range breaker.buckets {
+			breaker.buckets[i] = windowBucket{}
+		}
+		c.notifyRecovered(backend, now)
+	}
+}
+
+func (c *CircuitBreakers) bucket(breaker *circuitBreaker, now time.Time) *windowBucket {
+	second := now.Unix()
+	bucket := &breaker.buckets[second%int64(len(breaker.buckets))]
+	if bucket.second != second {
+		*bucket = windowBucket{second: second}
+	}
+	return bucket
+}
+
+func (c *CircuitBreakers) windowStats(breaker *circuitBreaker, now time.Time) (total, failures int) {
+	oldest := now.Unix() - int64(len(breaker.buckets))
+	for _, bucket := range breaker.buckets {
+		if bucket.second > oldest {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
+
+// State возвращает состояние выключателя бэкенда
+func (c *CircuitBreakers) State(backend *url.URL) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if breaker, ok := c.breakers[backend.String()]; ok {
+		return breaker.state
+	}
+	return CircuitClosed
+}
+
+// States возвращает текущее состояние всех выключателей
+func (c *CircuitBreakers) States() []entity.CircuitBreakerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	states := []entity.CircuitBreakerState{}
+	for key, breaker := range c.breakers {
+		total, failures := c.windowStats(breaker, now)
+		states = append(states, entity.CircuitBreakerState{
+			Backend:  key,
+			State:    breaker.state,
+			Since:    breaker.since,
+			Requests: total,
+			Failures: failures,
+		})
+	}
+	return states
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// источники ID клиента в сертификате
+const (
+	IdentitySPIFFE = "spiffe" // SPIFFE ID из SAN URI со схемой spiffe
+	IdentityURI    = "uri"    // первый SAN URI
+	IdentityCN     = "cn"     // Common Name субъекта
+)
+
+// CertificateIdentifierService определяет клиента по проверенному клиентскому сертификату,
+// а без сертификата - по API-ключу или IP, как ClientIdentifierService
+type CertificateIdentifierService struct {
+	*ClientIdentifierService
+	sources    []string
+	certPrefix string
+}
+
+func NewCertificateIdentifierService(fallback *ClientIdentifierService, sources []string) (*CertificateIdentifierService, error) {
+	if len(sources) == 0 {
+		sources = []string{IdentitySPIFFE, IdentityURI, IdentityCN}
+	}
+	for _, source := range sources {
+		switch source {
+		case IdentitySPIFFE, IdentityURI, IdentityCN:
+		default:
+			return nil, fmt.Errorf("unknown client identity source %q", source)
+		}
+	}
+
+	return &CertificateIdentifierService{
+		ClientIdentifierService: fallback,
+		sources:                 sources,
+		certPrefix:              "cert:",
+	}, nil
+}
+
+// определяет ID клиента из запроса, сертификат имеет приоритет над API-ключом
+func (s *CertificateIdentifierService) IdentifyClient(r *http.Request) string {
+	if id := s.GetCertificateID(r); id != "" {
+		return s.certPrefix + id
+	}
+	return s.ClientIdentifierService.IdentifyClient(r)
+}
+
+// GetCertificateID возвращает ID из первого подходящего источника сертификата.
+// Непроверенные сертификаты не учитываются, иначе клиент мог бы выдать себя за другого
+func (s *CertificateIdentifierService) GetCertificateID(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	cert := r.TLS.PeerCertificates[0]
+
+	for _, source := range s.sources {
+		switch source {
+		case IdentitySPIFFE:
+			for _, uri := range cert.URIs {
+				if uri.Scheme == "spiffe" && uri.Host != "" {
+					return uri.String()
+				}
+			}
+		case IdentityURI:
+			if len(cert.URIs) > 0 {
+				return cert.URIs[0].String()
+			}
+		case IdentityCN:
+			if cert.Subject.CommonName != "" {
+				return cert.Subject.CommonName
+			}
+		}
+	}
+	return ""
+}
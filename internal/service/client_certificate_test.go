@@ -0,0 +1,73 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCertificateIdentifier_Sources(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/partner/billing")
+	uri, _ := url.Parse("https://partner.example.com/client")
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "partner.example.com"},
+		URIs:    []*url.URL{uri, spiffe},
+	}
+
+	tests := []struct {
+		sources []string
+		want    string
+	}{
+		{nil, "cert:spiffe://example.org/partner/billing"},
+		{[]string{IdentityURI}, "cert:https://partner.example.com/client"},
+		{[]string{IdentityCN, IdentitySPIFFE}, "cert:partner.example.com"},
+	}
+
+	for _, tt := range tests {
+		identifier, err := NewCertificateIdentifierService(NewClientIdentifierService(true), tt.sources)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+		if got := identifier.IdentifyClient(r); got != tt.want {
+			t.Errorf("sources %v: expected %q, got %q", tt.sources, tt.want, got)
+		}
+	}
+}
+
+func TestCertificateIdentifier_Fallback(t *testing.T) {
+	identifier, err := NewCertificateIdentifierService(NewClientIdentifierService(true), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// без сертификата используется API-ключ
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-API-Key", "premium_client")
+	if got := identifier.IdentifyClient(r); got != "premium_client" {
+		t.Errorf("expected API key, got %q", got)
+	}
+
+	// непроверенный сертификат не учитывается
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "premium_client"}}
+	r = httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if got := identifier.IdentifyClient(r); got != "ip:10.0.0.1" {
+		t.Errorf("expected IP for unverified certificate, got %q", got)
+	}
+}
+
+func TestCertificateIdentifier_UnknownSource(t *testing.T) {
+	if _, err := NewCertificateIdentifierService(NewClientIdentifierService(true), []string{"email"}); err == nil {
+		t.Error("expected error for unknown identity source")
+	}
+}
@@ -1,14 +1,40 @@
 package service
 
 import (
+	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 )
 
+// источники IP клиента
+const (
+	ClientIPFromHeaders       = "headers"        // X-Forwarded-For, Forwarded и X-Real-IP от доверенных прокси
+	ClientIPFromProxyProtocol = "proxy_protocol" // адрес соединения, переданный балансировщиком по PROXY protocol
+)
+
+// заголовки с цепочкой прокси, которым можно доверять
+const (
+	ClientIPHeaderXForwardedFor = "x-forwarded-for"
+	ClientIPHeaderForwarded     = "forwarded" // RFC 7239
+)
+
+// ClientIPConfig описывает, каким источникам адреса клиента можно доверять
+type ClientIPConfig struct {
+	TrustedProxies []string // адреса и подсети прокси, чьим заголовкам можно доверять
+	Source         string
+	Header         string // заголовок, который заполняют доверенные прокси, по умолчанию X-Forwarded-For
+	LegacyHeaders  bool   // прежнее поведение: первый адрес X-Forwarded-For без проверки, позволяет подменить IP
+}
+
 type ClientIdentifierService struct {
 	prioritizeAPIKey bool
 	ipPrefix         string
+	trustedProxies   []netip.Prefix
+	source           string
+	header           string
+	legacyHeaders    bool
 }
 
 func NewClientIdentifierService(prioritizeAPIKey bool) *ClientIdentifierService {
@@ -50,7 +76,161 @@ func (s *ClientIdentifierService) GetAPIKey(r *http.Request) string {
 	return ""
 }
 
+// SetClientIPConfig задает доверенные прокси и источник адреса клиента
+func (s *ClientIdentifierService) SetClientIPConfig(config ClientIPConfig) error {
+	switch config.Source {
+	case "", ClientIPFromHeaders, ClientIPFromProxyProtocol:
+	default:
+		return fmt.Errorf("unknown client ip source %q", config.Source)
+	}
+
+	header := strings.ToLower(config.Header)
+	switch header {
+	case "":
+		header = ClientIPHeaderXForwardedFor
+	case ClientIPHeaderXForwardedFor, ClientIPHeaderForwarded:
+	default:
+		return fmt.Errorf("unknown client ip header %q", config.Header)
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(config.TrustedProxies))
+	for _, proxy := range config.TrustedProxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	s.trustedProxies = prefixes
+	s.source = config.Source
+	s.header = header
+	s.legacyHeaders = config.LegacyHeaders
+	return nil
+}
+
+// parsePrefix принимает подсеть или отдельный адрес
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func (s *ClientIdentifierService) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *ClientIdentifierService) GetClientIP(r *http.Request) string {
+	if s.legacyHeaders {
+		return s.legacyClientIP(r)
+	}
+
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return remoteHost(r)
+	}
+	addr := remote.Addr().Unmap()
+
+	// за балансировщиком с PROXY protocol адрес соединения уже принадлежит клиенту
+	if s.source == ClientIPFromProxyProtocol || !s.isTrusted(addr) {
+		return addr.String()
+	}
+
+	// разбирается только заголовок, который заполняют доверенные прокси: второй
+	// заголовок клиент может прислать сам и подменить свой адрес
+	var hops []string
+	if s.header == ClientIPHeaderForwarded {
+		hops = parseForwarded(r.Header.Values("Forwarded"))
+	} else {
+		hops = parseXForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+
+	// цепочка прокси разбирается справа налево до первого недоверенного адреса
+	if len(hops) == 0 {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap().String()
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			break
+		}
+		addr = hop
+		if !s.isTrusted(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// parseXForwardedFor возвращает адреса из всех заголовков X-Forwarded-For по порядку
+func parseXForwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseForwarded возвращает значения параметра for из заголовков Forwarded (RFC 7239)
+func parseForwarded(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = strings.Trim(val, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseHop разбирает адрес с необязательным портом; unknown и скрытые имена не принимаются
+func parseHop(hop string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func remoteHost(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+func (s *ClientIdentifierService) legacyClientIP(r *http.Request) string {
 	// проверяем заголовки X-Forwarded-For и X-Real-IP и в крайнем случае используем RemoteAddr
 	forwardedFor := r.Header.Get("X-Forwarded-For")
 	if forwardedFor != "" {
@@ -62,9 +242,5 @@ func (s *ClientIdentifierService) GetClientIP(r *http.Request) string {
 		return realIP
 	}
 
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return ip
+	return remoteHost(r)
 }
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIdentifier_TrustedProxies(t *testing.T) {
+	identifier := NewClientIdentifierService(true)
+	err := identifier.SetClientIPConfig(ClientIPConfig{
+		TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"untrusted peer headers ignored", "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.5"},
+		{"stops at first untrusted hop", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"all hops trusted", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "192.168.1.1, 10.0.0.2"}, "192.168.1.1"},
+		{"forwarded ignored by default", "10.0.0.1:1234", map[string]string{"Forwarded": "for=198.51.100.7", "X-Forwarded-For": "1.1.1.1"}, "1.1.1.1"},
+		{"real ip from trusted peer", "10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+		{"real ip from untrusted peer", "203.0.113.5:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := identifier.GetClientIP(r); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClientIdentifier_ForwardedHeader(t *testing.T) {
+	identifier := NewClientIdentifierService(true)
+	err := identifier.SetClientIPConfig(ClientIPConfig{
+		TrustedProxies: []string{"10.0.0.0/8"},
+		Header:         ClientIPHeaderForwarded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"forwarded header", map[string]string{"Forwarded": `for=1.1.1.1, for="[2001:db8::17]:4711";proto=https`}, "2001:db8::17"},
+		{"obfuscated hop", map[string]string{"Forwarded": "for=198.51.100.7, for=_hidden"}, "10.0.0.1"},
+		{"xff ignored", map[string]string{"Forwarded": "for=198.51.100.7", "X-Forwarded-For": "1.1.1.1"}, "198.51.100.7"},
+		{"only xff sent", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := identifier.GetClientIP(r); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClientIdentifier_Sources(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, 198.51.100.7")
+
+	// адрес из PROXY protocol не перекрывается заголовками
+	identifier := NewClientIdentifierService(true)
+	if err := identifier.SetClientIPConfig(ClientIPConfig{TrustedProxies: []string{"10.0.0.0/8"}, Source: ClientIPFromProxyProtocol}); err != nil {
+		t.Fatal(err)
+	}
+	if got := identifier.GetClientIP(r); got != "10.0.0.1" {
+		t.Errorf("expected connection address, got %s", got)
+	}
+
+	// прежнее поведение доступно только явно
+	if err := identifier.SetClientIPConfig(ClientIPConfig{LegacyHeaders: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := identifier.GetClientIP(r); got != "1.1.1.1" {
+		t.Errorf("expected first forwarded address, got %s", got)
+	}
+}
+
+func TestClientIdentifier_InvalidConfig(t *testing.T) {
+	identifier := NewClientIdentifierService(true)
+	if err := identifier.SetClientIPConfig(ClientIPConfig{TrustedProxies: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("expected error for invalid trusted proxy")
+	}
+	if err := identifier.SetClientIPConfig(ClientIPConfig{Source: "header"}); err == nil {
+		t.Error("expected error for unknown source")
+	}
+	if err := identifier.SetClientIPConfig(ClientIPConfig{Header: "x-real-ip"}); err == nil {
+		t.Error("expected error for unknown header")
+	}
+}
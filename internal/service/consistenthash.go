@@ -0,0 +1,146 @@
+package service
+
+import (
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+type ringNode struct {
+	hash    uint64
+	backend *url.URL
+}
+
+// ConsistentHashBalancer распределяет запросы по кольцу консистентного хеширования
+// с виртуальными узлами: запросы с одинаковым ключом попадают на один и тот же бэкенд,
+// а при добавлении или удалении бэкенда переназначается только часть ключей
+type ConsistentHashBalancer struct {
+	filterChain
+	connTracker
+	backends     []*url.URL
+	ring         []ringNode
+	virtualNodes int
+	counter      atomic.Uint64
+	mutex        sync.RWMutex
+}
+
+func NewConsistentHashBalancer(backends []*url.URL, virtualNodes int) *ConsistentHashBalancer {
+	if virtualNodes <= 0 {
+		virtualNodes = 100
+	}
+
+	b := &ConsistentHashBalancer{
+		backends:     backends,
+		virtualNodes: virtualNodes,
+	}
+	b.rebuild()
+	return b
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// rebuild пересобирает кольцо, вызывается под блокировкой на запись
+func (b *ConsistentHashBalancer) rebuild() {
+	ring := make([]ringNode, 0, len(b.backends)*b.virtualNodes)
+	for _, backend := range b.backends {
+		for i := 0; i < b.virtualNodes; i++ {
+			ring = append(ring, ringNode{
+				hash:    hashKey(backend.String() + "#" + strconv.Itoa(i)),
+				backend: backend,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	b.ring = ring
+}
+
+// AddBackend добавляет бэкенд на кольцо, вес не учитывается
+func (b *ConsistentHashBalancer) AddBackend(backend *url.URL, weight int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.backends = append(b.backends, backend)
+	b.rebuild()
+}
+
+func (b *ConsistentHashBalancer) RemoveBackend(backend *url.URL) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for i, u := range b.backends {
+		if u.String() == backend.String() {
+			b.backends = append(b.backends[:i], b.backends[i+1:]...)
+			b.rebuild()
+			return true
+		}
+	}
+	return false
+}
+
+func (b *ConsistentHashBalancer) GetBackends() []*url.URL {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	result := make([]*url.URL, len(b.backends))
+	copy(result, b.backends)
+	return result
+}
+
+// NextForKey возвращает бэкенд, за которым закреплен ключ. Если он недоступен,
+// выбирается следующий по кольцу доступный бэкенд
+func (b *ConsistentHashBalancer) NextForKey(key string) *url.URL {
+	return b.nextOnRing(key, b.IsAvailable)
+}
+
+// Next используется для запросов без ключа и распределяет их по кольцу равномерно
+func (b *ConsistentHashBalancer) Next() *url.URL {
+	return b.nextOnRing(strconv.FormatUint(b.counter.Add(1), 10), b.isSelectable)
+}
+
+// nextOnRing ищет по кольцу от ключа первый бэкенд, который пропускает available
+func (b *ConsistentHashBalancer) nextOnRing(key string, available func(backend *url.URL) bool) *url.URL {
+	// кольцо пересобирается в новый слайс, поэтому по снимку можно идти без блокировки,
+	// не удерживая ее во время вызова фильтров
+	b.mutex.RLock()
+	ring, backendCount := b.ring, len(b.backends)
+	b.mutex.RUnlock()
+
+	if len(ring) == 0 {
+		return nil
+	}
+
+	hash := hashKey(key)
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+
+	if backend := walkRing(ring, start, backendCount, available); backend != nil {
+		return backend
+	}
+
+	// если недоступны все бэкенды, оставляем ключ на его основном бэкенде,
+	// а если он выводится из работы - на следующем по кольцу
+	return walkRing(ring, start, backendCount, b.isAllowed)
+}
+
+// walkRing обходит кольцо от позиции start и возвращает первый бэкенд, который пропускает available
+func walkRing(ring []ringNode, start, backendCount int, available func(backend *url.URL) bool) *url.URL {
+	checked := make(map[*url.URL]bool, backendCount)
+	for i := 0; i < len(ring) && len(checked) < backendCount; i++ {
+		node := ring[(start+i)%len(ring)]
+		if checked[node.backend] {
+			continue
+		}
+		if available(node.backend) {
+			return node.backend
+		}
+		checked[node.backend] = true
+	}
+	return nil
+}
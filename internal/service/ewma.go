@@ -0,0 +1,142 @@
+package service
+
+import (
+	"math/rand/v2"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/entity"
+)
+
+const (
+	// оценка бэкендов без замеров, пока ни у одного бэкенда пула нет замеров
+	defaultEWMALatency = 10 * time.Millisecond
+	// штраф за ответ 5xx или ошибку соединения, чтобы неисправный бэкенд не выглядел быстрым
+	ewmaFailurePenalty = time.Second
+)
+
+// EWMABalancer выбирает бэкенды с учетом экспоненциально взвешенного
+// скользящего среднего времени ответа. Из двух случайных бэкендов выбирается тот,
+// у которого меньше среднее время ответа с поправкой на число запросов в обработке
+type EWMABalancer struct {
+	filterChain
+	connTracker
+	backendList
+	alpha     float64 // вес нового замера в среднем
+	latencies map[string]time.Duration
+	mu        sync.RWMutex
+}
+
+func NewEWMABalancer(backends []*url.URL, alpha float64) *EWMABalancer {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.3
+	}
+
+	return &EWMABalancer{
+		backendList: backendList{backends: backends},
+		alpha:       alpha,
+		latencies:   make(map[string]time.Duration),
+	}
+}
+
+// ObserveLatency учитывает время ответа бэкенда в скользящем среднем
+func (b *EWMABalancer) ObserveLatency(backend *url.URL, duration time.Duration) {
+	if backend == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := backend.String()
+	current, ok := b.latencies[key]
+	if !ok {
+		b.latencies[key] = duration
+		return
+	}
+	b.latencies[key] = time.Duration(b.alpha*float64(duration) + (1-b.alpha)*float64(current))
+}
+
+// ObserveFailure учитывает неудачную попытку как время ответа со штрафом
+func (b *EWMABalancer) ObserveFailure(backend *url.URL, duration time.Duration) {
+	b.ObserveLatency(backend, duration+ewmaFailurePenalty)
+}
+
+// score - ожидаемая задержка с учетом уже отправленных на бэкенд запросов.
+// Бэкенды без замеров оцениваются средним по пулу, чтобы не получать весь трафик
+func (b *EWMABalancer) score(backend *url.URL) float64 {
+	b.mu.RLock()
+	latency, ok := b.latencies[backend.String()]
+	if !ok {
+		latency = b.averageLatency()
+	}
+	b.mu.RUnlock()
+
+	return float64(latency) * float64(b.InFlight(backend)+1)
+}
+
+// averageLatency возвращает среднее время ответа бэкендов с замерами, вызывается под mu
+func (b *EWMABalancer) averageLatency() time.Duration {
+	if len(b.latencies) == 0 {
+		return defaultEWMALatency
+	}
+
+	var total time.Duration
+	for _, latency := range b.latencies {
+		total += latency
+	}
+	return total / time.Duration(len(b.latencies))
+}
+
+func (b *EWMABalancer) Next() *url.URL {
+	backends := b.GetBackends()
+	if len(backends) == 0 {
+		return nil
+	}
+
+	available := make([]*url.URL, 0, len(backends))
+	for _, backend := range backends {
+		if b.isSelectable(backend) {
+			available = append(available, backend)
+		}
+	}
+	if len(available) == 0 {
+		available = b.allowed(backends)
+	}
+	if len(available) == 0 {
+		return nil
+	}
+	if len(available) == 1 {
+		return available[0]
+	}
+
+	i := rand.IntN(len(available))
+	j := rand.IntN(len(available) - 1)
+	if j >= i {
+		j++
+	}
+
+	if b.score(available[j]) < b.score(available[i]) {
+		return available[j]
+	}
+	return available[i]
+}
+
+// Latencies возвращает текущее среднее время ответа каждого бэкенда
+func (b *EWMABalancer) Latencies() []entity.BackendLatency {
+	backends := b.GetBackends()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	latencies := make([]entity.BackendLatency, 0, len(backends))
+	for _, backend := range backends {
+		latencies = append(latencies, entity.BackendLatency{
+			Backend:  backend.String(),
+			EWMAMs:   float64(b.latencies[backend.String()]) / float64(time.Millisecond),
+			InFlight: b.InFlight(backend),
+		})
+	}
+	return latencies
+}
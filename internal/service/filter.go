@@ -0,0 +1,97 @@
+package service
+
+import (
+	"net/url"
+	"sync"
+)
+
+// filterChain объединяет фильтры доступности бэкендов,
+// бэкенд доступен только если его пропускают все фильтры
+type filterChain struct {
+	filters   []BackendFilter
+	selection []BackendFilter // учитываются только при выборе бэкенда без ключа
+	required  []BackendFilter // соблюдаются даже когда недоступны все бэкенды
+	mu        sync.RWMutex
+}
+
+func (c *filterChain) AddFilter(filter BackendFilter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.filters = append(c.filters, filter)
+}
+
+// AddSelectionFilter добавляет фильтр, который действует только в Next. Закрепленные
+// за бэкендом клиенты и ключи не должны случайно переназначаться из-за такого фильтра
+func (c *filterChain) AddSelectionFilter(filter BackendFilter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.selection = append(c.selection, filter)
+}
+
+// AddRequiredFilter добавляет фильтр, который не обходится запасным выбором:
+// когда недоступны все бэкенды, балансировщик выбирает только среди тех, что он пропускает
+func (c *filterChain) AddRequiredFilter(filter BackendFilter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.required = append(c.required, filter)
+}
+
+// isAllowed проверяет бэкенд для запасного выбора, когда недоступны все бэкенды
+func (c *filterChain) isAllowed(backend *url.URL) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, filter := range c.required {
+		if !filter.IsAvailable(backend) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowed возвращает бэкенды, среди которых допустим запасной выбор
+func (c *filterChain) allowed(backends []*url.URL) []*url.URL {
+	result := make([]*url.URL, 0, len(backends))
+	for _, backend := range backends {
+		if c.isAllowed(backend) {
+			result = append(result, backend)
+		}
+	}
+	return result
+}
+
+// isSelectable проверяет бэкенд при выборе без ключа
+func (c *filterChain) isSelectable(backend *url.URL) bool {
+	if !c.IsAvailable(backend) {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, filter := range c.selection {
+		if !filter.IsAvailable(backend) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *filterChain) IsAvailable(backend *url.URL) bool {
+	if !c.isAllowed(backend) {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, filter := range c.filters {
+		if !filter.IsAvailable(backend) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthCheckConfig содержит настройки активной проверки бэкендов
+type HealthCheckConfig struct {
+	Enabled            bool
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	HealthyThreshold   int // успешных проверок подряд, чтобы вернуть бэкенд
+	UnhealthyThreshold int // неудачных проверок подряд, чтобы исключить бэкенд
+}
+
+type backendHealth struct {
+	healthy   bool
+	successes int
+	failures  int
+}
+
+// HealthChecker периодически опрашивает бэкенды балансировщика
+// и исключает из балансировки те, что не отвечают
+type HealthChecker struct {
+	recoveryNotifier
+	config   HealthCheckConfig
+	balancer Balancer
+	client   *http.Client
+	states   map[string]*backendHealth
+	mu       sync.RWMutex
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func NewHealthChecker(config HealthCheckConfig, balancer Balancer) *HealthChecker {
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Second
+	}
+	if config.HealthyThreshold <= 0 {
+		config.HealthyThreshold = 1
+	}
+	if config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = 1
+	}
+
+	return &HealthChecker{
+		config:   config,
+		balancer: balancer,
+		client:   &http.Client{Timeout: config.Timeout},
+		states:   make(map[string]*backendHealth),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// SetTransport задает протокол и TLS-настройки проверок такими же, как у запросов к бэкендам пула
+func (h *HealthChecker) SetTransport(protocol string, tlsConfig *tls.Config) {
+	h.client.Transport = NewUpstreamTransport(protocol, tlsConfig)
+}
+
+// Start запускает фоновые проверки, если они включены в конфигурации
+func (h *HealthChecker) Start() {
+	if !h.config.Enabled {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(h.config.Interval)
+		defer ticker.Stop()
+
+		h.checkAll()
+		for {
+			select {
+			case <-ticker.C:
+				h.checkAll()
+			case <-h.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (h *HealthChecker) Stop() {
+	h.stopOnce.Do(func() { close(h.stopCh) })
+}
+
+// IsAvailable возвращает false только для бэкендов, признанных нездоровыми.
+// Бэкенды, которые еще не проверялись, считаются здоровыми
+func (h *HealthChecker) IsAvailable(backend *url.URL) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	state, ok := h.states[backend.String()]
+	return !ok || state.healthy
+}
+
+func (h *HealthChecker) checkAll() {
+	backends := h.balancer.GetBackends()
+
+	var wg sync.WaitGroup
+	for _, backend := range backends {
+		wg.Add(1)
+		go func(backend *url.URL) {
+			defer wg.Done()
+			h.record(backend, h.probe(backend))
+		}(backend)
+	}
+	wg.Wait()
+
+	h.forgetRemoved(backends)
+}
+
+func (h *HealthChecker) probe(backend *url.URL) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
+	defer cancel()
+
+	target := strings.TrimSuffix(backend.String(), "/") + "/" + strings.TrimPrefix(h.config.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (h *HealthChecker) record(backend *url.URL, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := backend.String()
+	state, ok := h.states[key]
+	if !ok {
+		state = &backendHealth{healthy: true}
+		h.states[key] = state
+	}
+
+	if err == nil {
+		state.successes++
+		state.failures = 0
+		if !state.healthy && state.successes >= h.config.HealthyThreshold {
+			state.healthy = true
+			log.Printf("[HEALTH] Backend %s is healthy again", key)
+			h.notifyRecovered(backend, time.Now())
+		}
+		return
+	}
+
+	state.failures++
+	state.successes = 0
+	if state.healthy && state.failures >= h.config.UnhealthyThreshold {
+		state.healthy = false
+		log.Printf("[HEALTH] Backend %s marked unhealthy after %d failed checks: %v", key, state.failures, err)
+	}
+}
+
+// удаляет состояние бэкендов, которых больше нет в балансировщике
+func (h *HealthChecker) forgetRemoved(backends []*url.URL) {
+	current := make(map[string]struct{}, len(backends))
+	for _, backend := range backends {
+		current[backend.String()] = struct{}{}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for key := range h.states {
+		if _, ok := current[key]; !ok {
+			delete(h.states, key)
+		}
+	}
+}
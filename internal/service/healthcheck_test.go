@@ -0,0 +1,78 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHealthChecker_SkipsUnhealthyBackend(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	healthyURL, _ := url.Parse(healthy.URL)
+	brokenURL, _ := url.Parse(broken.URL)
+
+	balancer := NewRoundRobinBalancer([]*url.URL{healthyURL, brokenURL})
+	checker := NewHealthChecker(HealthCheckConfig{
+		Enabled:            true,
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 2,
+	}, balancer)
+	balancer.AddFilter(checker)
+
+	// одной неудачной проверки недостаточно для исключения
+	checker.checkAll()
+	if !checker.IsAvailable(brokenURL) {
+		t.Fatalf("Expected backend %s to stay available after one failed check", brokenURL)
+	}
+
+	checker.checkAll()
+	if checker.IsAvailable(brokenURL) {
+		t.Fatalf("Expected backend %s to be unavailable", brokenURL)
+	}
+
+	for i := 0; i < 4; i++ {
+		if backend := balancer.Next(); backend.String() != healthyURL.String() {
+			t.Errorf("Expected %s, got %s", healthyURL, backend)
+		}
+	}
+}
+
+func TestHealthChecker_UsesPoolProtocol(t *testing.T) {
+	h2cOnly := new(http.Protocols)
+	h2cOnly.SetUnencryptedHTTP2(true)
+
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	backend.Config.Protocols = h2cOnly
+	backend.Start()
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+
+	// бэкенд, принимающий только h2c, проверяется по протоколу пула
+	pool, err := NewPool(PoolConfig{
+		Name:        DefaultPool,
+		Backends:    []WeightedBackend{{URL: backendURL, Weight: 1}},
+		Protocol:    ProtocolH2C,
+		HealthCheck: HealthCheckConfig{Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	pool.HealthChecker.checkAll()
+	if !pool.HealthChecker.IsAvailable(backendURL) {
+		t.Errorf("Expected h2c backend %s to pass health check", backendURL)
+	}
+}
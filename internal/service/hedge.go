@@ -0,0 +1,95 @@
+package service
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	hedgeSamples    = 1024 // сколько последних задержек хранится для расчета перцентиля
+	hedgeMinSamples = 20   // до набора выборки используется задержка из конфигурации
+	hedgeRecompute  = 64   // перцентиль пересчитывается раз в столько наблюдений
+)
+
+// HedgeConfig содержит настройки дублирующих запросов маршрута
+type HedgeConfig struct {
+	Enabled    bool
+	Percentile float64       // перцентиль времени ответа (0..1), после которого отправляется дубль
+	Delay      time.Duration // задержка, пока статистики недостаточно
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+}
+
+// HedgePolicy считает задержку перед отправкой дублирующего запроса
+// по перцентилю недавних времен ответа бэкендов
+type HedgePolicy struct {
+	config   HedgeConfig
+	samples  []time.Duration
+	next     int
+	observed int
+	delay    time.Duration
+	mu       sync.Mutex
+}
+
+// NewHedgePolicy возвращает nil, если дублирование выключено
+func NewHedgePolicy(config HedgeConfig) *HedgePolicy {
+	if !config.Enabled {
+		return nil
+	}
+	if config.Percentile <= 0 || config.Percentile >= 1 {
+		config.Percentile = 0.95
+	}
+	if config.Delay <= 0 {
+		config.Delay = 100 * time.Millisecond
+	}
+	if config.MaxDelay > 0 && config.MaxDelay < config.MinDelay {
+		config.MaxDelay = config.MinDelay
+	}
+
+	return &HedgePolicy{
+		config:  config,
+		samples: make([]time.Duration, 0, hedgeSamples),
+		delay:   config.Delay,
+	}
+}
+
+// ObserveLatency учитывает время ответа бэкенда
+func (p *HedgePolicy) ObserveLatency(duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.samples) < hedgeSamples {
+		p.samples = append(p.samples, duration)
+	} else {
+		p.samples[p.next] = duration
+		p.next = (p.next + 1) % hedgeSamples
+	}
+	p.observed++
+
+	// сортировка выборки дорогая, поэтому перцентиль пересчитывается не на каждый ответ
+	if len(p.samples) == hedgeMinSamples ||
+		len(p.samples) > hedgeMinSamples && p.observed%hedgeRecompute == 0 {
+		p.delay = p.percentile()
+	}
+}
+
+// Delay возвращает, сколько ждать ответа перед отправкой дубля
+func (p *HedgePolicy) Delay() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delay := max(p.delay, p.config.MinDelay)
+	if p.config.MaxDelay > 0 {
+		delay = min(delay, p.config.MaxDelay)
+	}
+	return delay
+}
+
+func (p *HedgePolicy) percentile() time.Duration {
+	sorted := slices.Clone(p.samples)
+	slices.Sort(sorted)
+
+	index := int(p.config.Percentile * float64(len(sorted)))
+	return sorted[min(index, len(sorted)-1)]
+}
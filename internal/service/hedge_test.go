@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHedgePolicy_Delay(t *testing.T) {
+	if NewHedgePolicy(HedgeConfig{}) != nil {
+		t.Error("Expected nil policy when hedging is disabled")
+	}
+
+	policy := NewHedgePolicy(HedgeConfig{
+		Enabled:    true,
+		Percentile: 0.9,
+		Delay:      50 * time.Millisecond,
+		MinDelay:   5 * time.Millisecond,
+		MaxDelay:   500 * time.Millisecond,
+	})
+
+	// пока статистики нет, используется задержка из конфигурации
+	if got := policy.Delay(); got != 50*time.Millisecond {
+		t.Errorf("Expected initial delay 50ms, got %v", got)
+	}
+
+	for i := 1; i <= hedgeMinSamples; i++ {
+		policy.ObserveLatency(time.Duration(i) * time.Millisecond)
+	}
+	if got := policy.Delay(); got != 19*time.Millisecond {
+		t.Errorf("Expected p90 delay 19ms, got %v", got)
+	}
+
+	// задержка ограничивается сверху
+	for i := 0; i < hedgeRecompute*2; i++ {
+		policy.ObserveLatency(time.Second)
+	}
+	if got := policy.Delay(); got != 500*time.Millisecond {
+		t.Errorf("Expected delay capped at 500ms, got %v", got)
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"math/rand/v2"
+	"net/url"
+	"sync/atomic"
+)
+
+// LeastConnectionsBalancer выбирает бэкенд с наименьшим числом запросов в обработке
+type LeastConnectionsBalancer struct {
+	filterChain
+	connTracker
+	backendList
+	current atomic.Uint32
+}
+
+func NewLeastConnectionsBalancer(backends []*url.URL) *LeastConnectionsBalancer {
+	return &LeastConnectionsBalancer{
+		backendList: backendList{backends: backends},
+	}
+}
+
+func (b *LeastConnectionsBalancer) Next() *url.URL {
+	backends := b.GetBackends()
+	if len(backends) == 0 {
+		return nil
+	}
+
+	// обход начинается со сдвигом, чтобы при равной нагрузке бэкенды чередовались
+	offset := int(b.current.Add(1))
+	var best *url.URL
+	var bestLoad int64
+	for i := range backends {
+		backend := backends[(offset+i)%len(backends)]
+		if !b.isSelectable(backend) {
+			continue
+		}
+		if load := b.InFlight(backend); best == nil || load < bestLoad {
+			best, bestLoad = backend, load
+		}
+	}
+
+	if best != nil {
+		return best
+	}
+
+	// если недоступны все бэкенды, выбираем любой, кроме выводимых из работы
+	for i := range backends {
+		if backend := backends[(offset+i)%len(backends)]; b.isAllowed(backend) {
+			return backend
+		}
+	}
+	return nil
+}
+
+// PowerOfTwoChoicesBalancer выбирает два случайных бэкенда
+// и отправляет запрос на менее загруженный из них
+type PowerOfTwoChoicesBalancer struct {
+	filterChain
+	connTracker
+	backendList
+}
+
+func NewPowerOfTwoChoicesBalancer(backends []*url.URL) *PowerOfTwoChoicesBalancer {
+	return &PowerOfTwoChoicesBalancer{
+		backendList: backendList{backends: backends},
+	}
+}
+
+func (b *PowerOfTwoChoicesBalancer) Next() *url.URL {
+	backends := b.GetBackends()
+	if len(backends) == 0 {
+		return nil
+	}
+
+	available := make([]*url.URL, 0, len(backends))
+	for _, backend := range backends {
+		if b.isSelectable(backend) {
+			available = append(available, backend)
+		}
+	}
+	if len(available) == 0 {
+		available = b.allowed(backends)
+	}
+	if len(available) == 0 {
+		return nil
+	}
+	if len(available) == 1 {
+		return available[0]
+	}
+
+	i := rand.IntN(len(available))
+	j := rand.IntN(len(available) - 1)
+	if j >= i {
+		j++
+	}
+
+	if b.InFlight(available[j]) < b.InFlight(available[i]) {
+		return available[j]
+	}
+	return available[i]
+}
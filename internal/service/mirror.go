@@ -0,0 +1,101 @@
+package service
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/entity"
+)
+
+// MirrorConfig содержит настройки копирования запросов пула в теневой пул
+type MirrorConfig struct {
+	Pool    string        // теневой пул, пусто - зеркалирование выключено
+	Percent float64       // процент копируемых запросов (0..100)
+	Timeout time.Duration // таймаут теневого запроса
+}
+
+// Mirror копирует часть запросов в теневой пул и сравнивает
+// коды и время ответов теневого и основного пулов
+type Mirror struct {
+	Shadow  *Pool
+	percent float64
+	timeout time.Duration
+
+	mirrored       atomic.Uint64
+	dropped        atomic.Uint64
+	failed         atomic.Uint64
+	statusMatches  atomic.Uint64
+	statusDiffers  atomic.Uint64
+	primaryLatency atomic.Int64 // суммарное время ответа основного пула, нс
+	shadowLatency  atomic.Int64 // суммарное время ответа теневого пула, нс
+}
+
+func NewMirror(config MirrorConfig, shadow *Pool) *Mirror {
+	if config.Percent < 0 {
+		config.Percent = 0
+	}
+	if config.Percent > 100 {
+		config.Percent = 100
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	return &Mirror{
+		Shadow:  shadow,
+		percent: config.Percent,
+		timeout: config.Timeout,
+	}
+}
+
+// ShouldMirror решает, копировать ли очередной запрос
+func (m *Mirror) ShouldMirror() bool {
+	return m.percent > 0 && rand.Float64()*100 < m.percent
+}
+
+func (m *Mirror) Timeout() time.Duration {
+	return m.timeout
+}
+
+// RecordDropped учитывает копию, пропущенную из-за лимита одновременных теневых запросов
+func (m *Mirror) RecordDropped() {
+	m.dropped.Add(1)
+}
+
+// RecordFailure учитывает теневой запрос, завершившийся ошибкой соединения
+func (m *Mirror) RecordFailure() {
+	m.mirrored.Add(1)
+	m.failed.Add(1)
+}
+
+// Record сравнивает ответы основного и теневого пулов на один запрос
+func (m *Mirror) Record(primaryStatus int, primaryLatency time.Duration, shadowStatus int, shadowLatency time.Duration) {
+	m.mirrored.Add(1)
+	if primaryStatus == shadowStatus {
+		m.statusMatches.Add(1)
+	} else {
+		m.statusDiffers.Add(1)
+	}
+	m.primaryLatency.Add(int64(primaryLatency))
+	m.shadowLatency.Add(int64(shadowLatency))
+}
+
+// Stats возвращает статистику зеркалирования
+func (m *Mirror) Stats() entity.MirrorStats {
+	stats := entity.MirrorStats{
+		ShadowPool:    m.Shadow.Name,
+		Percent:       m.percent,
+		Mirrored:      m.mirrored.Load(),
+		Dropped:       m.dropped.Load(),
+		Failed:        m.failed.Load(),
+		StatusMatches: m.statusMatches.Load(),
+		StatusDiffers: m.statusDiffers.Load(),
+	}
+
+	if compared := stats.StatusMatches + stats.StatusDiffers; compared > 0 {
+		stats.PrimaryAvgMs = float64(m.primaryLatency.Load()) / float64(compared) / float64(time.Millisecond)
+		stats.ShadowAvgMs = float64(m.shadowLatency.Load()) / float64(compared) / float64(time.Millisecond)
+	}
+	return stats
+}
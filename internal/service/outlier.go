@@ -0,0 +1,178 @@
+package service
+
+import (
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/entity"
+)
+
+// OutlierDetectionConfig содержит настройки пассивного исключения бэкендов
+type OutlierDetectionConfig struct {
+	Enabled            bool
+	ConsecutiveErrors  int           // ошибок подряд для исключения
+	BaseEjectionTime   time.Duration // длительность первого исключения
+	MaxEjectionTime    time.Duration // верхняя граница длительности исключения
+	MaxEjectionPercent int           // доля пула, которую можно исключить одновременно
+}
+
+type outlierState struct {
+	consecutiveErrors int
+	ejections         int // сколько раз подряд бэкенд исключался
+	ejectedUntil      time.Time
+}
+
+// OutlierDetector исключает бэкенды по статистике проксируемых ответов:
+// после N ошибок подряд бэкенд выводится из балансировки на время,
+// которое удваивается при каждом повторном исключении
+type OutlierDetector struct {
+	recoveryNotifier
+	config   OutlierDetectionConfig
+	balancer Balancer
+	states   map[string]*outlierState
+	mu       sync.Mutex
+}
+
+func NewOutlierDetector(config OutlierDetectionConfig, balancer Balancer) *OutlierDetector {
+	if config.ConsecutiveErrors <= 0 {
+		config.ConsecutiveErrors = 5
+	}
+	if config.BaseEjectionTime <= 0 {
+		config.BaseEjectionTime = 30 * time.Second
+	}
+	if config.MaxEjectionTime < config.BaseEjectionTime {
+		config.MaxEjectionTime = config.BaseEjectionTime
+	}
+	if config.MaxEjectionPercent <= 0 || config.MaxEjectionPercent > 100 {
+		config.MaxEjectionPercent = 50
+	}
+
+	return &OutlierDetector{
+		config:   config,
+		balancer: balancer,
+		states:   make(map[string]*outlierState),
+	}
+}
+
+func (d *OutlierDetector) ReportSuccess(backend *url.URL) {
+	if !d.config.Enabled || backend == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if state, ok := d.states[backend.String()]; ok {
+		state.consecutiveErrors = 0
+	}
+}
+
+func (d *OutlierDetector) ReportFailure(backend *url.URL) {
+	if !d.config.Enabled || backend == nil {
+		return
+	}
+
+	// состав пула читается до блокировки детектора: балансировщик вызывает IsAvailable
+	// под своей блокировкой, и обратный порядок привел бы к взаимоблокировке
+	backends := d.balancer.GetBackends()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := backend.String()
+	state, ok := d.states[key]
+	if !ok {
+		state = &outlierState{}
+		d.states[key] = state
+	}
+
+	now := time.Now()
+	if now.Before(state.ejectedUntil) {
+		return
+	}
+
+	state.consecutiveErrors++
+	if state.consecutiveErrors < d.config.ConsecutiveErrors {
+		return
+	}
+
+	if !d.canEject(now, backends) {
+		log.Printf("[OUTLIER] Backend %s reached %d consecutive errors but max ejection percent (%d%%) is reached",
+			key, state.consecutiveErrors, d.config.MaxEjectionPercent)
+		return
+	}
+
+	// множитель сбрасывается, если бэкенд долго проработал без исключений
+	if now.Sub(state.ejectedUntil) > d.config.MaxEjectionTime {
+		state.ejections = 0
+	}
+	state.ejections++
+
+	duration := d.config.BaseEjectionTime << (state.ejections - 1)
+	if duration > d.config.MaxEjectionTime || duration <= 0 {
+		duration = d.config.MaxEjectionTime
+	}
+	state.ejectedUntil = now.Add(duration)
+
+	log.Printf("[OUTLIER] Backend %s ejected for %v after %d consecutive errors (ejection #%d)",
+		key, duration, state.consecutiveErrors, state.ejections)
+	state.consecutiveErrors = 0
+
+	// бэкенд вернется в балансировку сам по окончании исключения
+	d.notifyRecovered(backend, state.ejectedUntil)
+}
+
+// canEject проверяет, не превысит ли еще одно исключение допустимую долю пула.
+// Учитываются только бэкенды, которые сейчас входят в пул
+func (d *OutlierDetector) canEject(now time.Time, backends []*url.URL) bool {
+	total := len(backends)
+	if total == 0 {
+		return false
+	}
+
+	ejected := 0
+	for _, backend := range backends {
+		if state, ok := d.states[backend.String()]; ok && now.Before(state.ejectedUntil) {
+			ejected++
+		}
+	}
+
+	return (ejected+1)*100 <= total*d.config.MaxEjectionPercent
+}
+
+// Forget удаляет статистику бэкенда, удаленного из пула
+func (d *OutlierDetector) Forget(backend *url.URL) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.states, backend.String())
+}
+
+func (d *OutlierDetector) IsAvailable(backend *url.URL) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.states[backend.String()]
+	return !ok || !time.Now().Before(state.ejectedUntil)
+}
+
+// Ejections возвращает бэкенды, исключенные в данный момент
+func (d *OutlierDetector) Ejections() []entity.OutlierEjection {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	ejections := []entity.OutlierEjection{}
+	for key, state := range d.states {
+		if now.Before(state.ejectedUntil) {
+			ejections = append(ejections, entity.OutlierEjection{
+				Backend:       key,
+				EjectedUntil:  state.ejectedUntil,
+				EjectionCount: state.ejections,
+			})
+		}
+	}
+	return ejections
+}
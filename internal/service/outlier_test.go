@@ -0,0 +1,133 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestOutlierDetector_EjectsAfterConsecutiveErrors(t *testing.T) {
+	backend1, _ := url.Parse("http://backend1")
+	backend2, _ := url.Parse("http://backend2")
+	balancer := NewRoundRobinBalancer([]*url.URL{backend1, backend2})
+
+	detector := NewOutlierDetector(OutlierDetectionConfig{
+		Enabled:            true,
+		ConsecutiveErrors:  3,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    time.Hour,
+		MaxEjectionPercent: 50,
+	}, balancer)
+
+	// успешный ответ сбрасывает счетчик ошибок подряд
+	detector.ReportFailure(backend1)
+	detector.ReportFailure(backend1)
+	detector.ReportSuccess(backend1)
+	detector.ReportFailure(backend1)
+	if !detector.IsAvailable(backend1) {
+		t.Fatal("Expected backend to stay available after non-consecutive errors")
+	}
+
+	detector.ReportFailure(backend1)
+	detector.ReportFailure(backend1)
+	if detector.IsAvailable(backend1) {
+		t.Fatal("Expected backend to be ejected")
+	}
+
+	// второй бэкенд исключить нельзя: это превысит 50% пула
+	for i := 0; i < 3; i++ {
+		detector.ReportFailure(backend2)
+	}
+	if !detector.IsAvailable(backend2) {
+		t.Fatal("Expected max ejection percent to protect the last backend")
+	}
+
+	if ejections := detector.Ejections(); len(ejections) != 1 || ejections[0].Backend != backend1.String() {
+		t.Errorf("Unexpected ejections: %+v", ejections)
+	}
+}
+
+func TestOutlierDetector_IgnoresRemovedBackends(t *testing.T) {
+	var backends []WeightedBackend
+	for _, raw := range []string{"http://a", "http://b", "http://c"} {
+		u, _ := url.Parse(raw)
+		backends = append(backends, WeightedBackend{URL: u, Weight: 1})
+	}
+
+	pool, err := NewPool(PoolConfig{
+		Name:     DefaultPool,
+		Backends: backends,
+		OutlierDetection: OutlierDetectionConfig{
+			Enabled:            true,
+			ConsecutiveErrors:  1,
+			MaxEjectionPercent: 50,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	a, b := backends[0].URL, backends[1].URL
+
+	pool.OutlierDetector.ReportFailure(a)
+	if pool.OutlierDetector.IsAvailable(a) {
+		t.Fatal("Expected backend to be ejected")
+	}
+
+	// исключение удаленного бэкенда не занимает долю оставшегося пула
+	if err := pool.RemoveBackend(a.String()); err != nil {
+		t.Fatalf("failed to remove backend: %v", err)
+	}
+	pool.OutlierDetector.ReportFailure(b)
+	if pool.OutlierDetector.IsAvailable(b) {
+		t.Error("Expected backend to be ejected after removed backend is forgotten")
+	}
+	if ejections := pool.OutlierDetector.Ejections(); len(ejections) != 1 {
+		t.Errorf("Unexpected ejections: %+v", ejections)
+	}
+}
+
+func TestOutlierDetector_ConcurrentWithBalancer(t *testing.T) {
+	var backends []WeightedBackend
+	for _, raw := range []string{"http://a", "http://b", "http://c", "http://d"} {
+		u, _ := url.Parse(raw)
+		backends = append(backends, WeightedBackend{URL: u, Weight: 1})
+	}
+
+	for _, strategy := range []string{StrategyWeightedRoundRobin, StrategyRoundRobin, StrategyConsistentHash} {
+		pool, err := NewPool(PoolConfig{
+			Name:     DefaultPool,
+			Backends: backends,
+			Balancer: BalancerConfig{Strategy: strategy},
+			OutlierDetection: OutlierDetectionConfig{
+				Enabled:           true,
+				ConsecutiveErrors: 1,
+				BaseEjectionTime:  time.Millisecond,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+
+		// выбор бэкенда и учет ошибок из разных горутин не должны блокировать друг друга
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 2000; i++ {
+				pool.OutlierDetector.ReportFailure(backends[i%len(backends)].URL)
+				if i%100 == 0 {
+					pool.AddBackend("http://extra", 1)
+					pool.RemoveBackend("http://extra")
+				}
+			}
+		}()
+		for i := 0; i < 2000; i++ {
+			pool.Balancer.Next()
+		}
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: deadlock between balancer and outlier detector", strategy)
+		}
+	}
+}
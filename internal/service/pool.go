@@ -0,0 +1,274 @@
+package service
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/entity"
+)
+
+const DefaultPool = "default"
+
+var (
+	ErrBackendExists   = errors.New("backend already exists")
+	ErrBackendNotFound = errors.New("backend not found")
+	ErrLastBackend     = errors.New("cannot remove or drain the last active backend of a pool")
+)
+
+// Протоколы, по которым прокси обращается к бэкендам пула
+const (
+	ProtocolHTTP1 = "http1" // только HTTP/1.1
+	ProtocolHTTP2 = "http2" // HTTP/2 к TLS-бэкендам с откатом на HTTP/1.1
+	ProtocolH2C   = "h2c"   // HTTP/2 без TLS с заранее известной поддержкой (prior knowledge)
+)
+
+// PoolConfig содержит настройки пула бэкендов
+type PoolConfig struct {
+	Name             string
+	Backends         []WeightedBackend
+	Balancer         BalancerConfig
+	Timeout          time.Duration
+	Protocol         string
+	TLS              UpstreamTLSConfig
+	Retry            RetryPolicyConfig
+	Canary           CanaryConfig
+	HealthCheck      HealthCheckConfig
+	OutlierDetection OutlierDetectionConfig
+	CircuitBreaker   CircuitBreakerConfig
+	SlowStart        SlowStartConfig
+}
+
+// Pool объединяет бэкенды одного сервиса с балансировщиком
+// и механизмами исключения недоступных бэкендов
+type Pool struct {
+	Name            string
+	Balancer        Balancer
+	HealthChecker   *HealthChecker
+	OutlierDetector *OutlierDetector
+	CircuitBreakers *CircuitBreakers
+	SlowStart       *SlowStart
+	RetryPolicy     *RetryPolicy
+	Mirror          *Mirror // nil, если запросы пула не копируются в теневой пул
+	Canary          *Canary
+	Timeout         time.Duration
+	Protocol        string
+	TLSConfig       *tls.Config // nil - настройки TLS по умолчанию
+
+	balancer managedBalancer
+	draining sync.Map // URL бэкенда -> struct{}
+	weights  map[string]int
+	mu       sync.Mutex
+}
+
+func NewPool(config PoolConfig) (*Pool, error) {
+	if config.Name == "" {
+		return nil, errors.New("pool name is required")
+	}
+	if len(config.Backends) == 0 {
+		return nil, fmt.Errorf("pool %q has no backends", config.Name)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 60 * time.Second
+	}
+	switch config.Protocol {
+	case "":
+		config.Protocol = ProtocolHTTP1
+	case ProtocolHTTP1, ProtocolHTTP2, ProtocolH2C:
+	default:
+		return nil, fmt.Errorf("pool %q: unknown protocol %q", config.Name, config.Protocol)
+	}
+
+	balancer, err := newBalancer(config.Balancer, config.Backends)
+	if err != nil {
+		return nil, fmt.Errorf("pool %q: %w", config.Name, err)
+	}
+
+	canary, err := NewCanary(config.Canary)
+	if err != nil {
+		return nil, fmt.Errorf("pool %q: %w", config.Name, err)
+	}
+
+	tlsConfig, err := NewUpstreamTLS(config.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("pool %q: %w", config.Name, err)
+	}
+
+	healthChecker := NewHealthChecker(config.HealthCheck, balancer)
+	healthChecker.SetTransport(config.Protocol, tlsConfig)
+	balancer.AddFilter(healthChecker)
+
+	outlierDetector := NewOutlierDetector(config.OutlierDetection, balancer)
+	balancer.AddFilter(outlierDetector)
+
+	circuitBreakers := NewCircuitBreakers(config.CircuitBreaker)
+	balancer.AddFilter(circuitBreakers)
+
+	// плавный ввод в работу масштабирует вес там, где стратегия учитывает веса
+	slowStart := NewSlowStart(config.SlowStart)
+	if scalable, ok := balancer.(interface {
+		SetWeightScale(scale func(backend *url.URL) float64)
+	}); ok {
+		scalable.SetWeightScale(slowStart.Factor)
+	} else {
+		// только для выбора без ключа: закрепленные клиенты остаются на своем бэкенде
+		balancer.AddSelectionFilter(slowStart)
+	}
+	healthChecker.AddRecoveryListener(slowStart)
+	outlierDetector.AddRecoveryListener(slowStart)
+	circuitBreakers.AddRecoveryListener(slowStart)
+
+	pool := &Pool{
+		Name:            config.Name,
+		Balancer:        balancer,
+		HealthChecker:   healthChecker,
+		OutlierDetector: outlierDetector,
+		CircuitBreakers: circuitBreakers,
+		SlowStart:       slowStart,
+		RetryPolicy:     NewRetryPolicy(config.Retry),
+		Canary:          canary,
+		Timeout:         config.Timeout,
+		Protocol:        config.Protocol,
+		TLSConfig:       tlsConfig,
+		balancer:        balancer,
+		weights:         make(map[string]int, len(config.Backends)),
+	}
+	// выводимые из работы бэкенды не получают новых запросов даже когда недоступны остальные
+	balancer.AddRequiredFilter(drainFilter{pool: pool})
+
+	for _, backend := range config.Backends {
+		pool.weights[backend.URL.String()] = max(backend.Weight, 1)
+	}
+
+	return pool, nil
+}
+
+func (p *Pool) Start() {
+	p.HealthChecker.Start()
+}
+
+func (p *Pool) Stop() {
+	p.HealthChecker.Stop()
+}
+
+// drainFilter не пропускает новые запросы на бэкенды, выводимые из работы
+type drainFilter struct {
+	pool *Pool
+}
+
+func (f drainFilter) IsAvailable(backend *url.URL) bool {
+	_, draining := f.pool.draining.Load(backend.String())
+	return !draining
+}
+
+func (p *Pool) find(rawURL string) (*url.URL, bool) {
+	for _, backend := range p.balancer.GetBackends() {
+		if backend.String() == rawURL {
+			return backend, true
+		}
+	}
+	return nil, false
+}
+
+// AddBackend добавляет бэкенд в пул без перезапуска прокси
+func (p *Pool) AddBackend(rawURL string, weight int) error {
+	backend, err := url.Parse(rawURL)
+	if err != nil || backend.Scheme == "" || backend.Host == "" {
+		return fmt.Errorf("invalid backend url %q", rawURL)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.find(backend.String()); exists {
+		return ErrBackendExists
+	}
+
+	weight = max(weight, 1)
+	p.SlowStart.BackendRecovered(backend, time.Now())
+	p.balancer.AddBackend(backend, weight)
+	p.weights[backend.String()] = weight
+	return nil
+}
+
+// RemoveBackend удаляет бэкенд из пула. Запросы, уже отправленные на него, завершаются
+func (p *Pool) RemoveBackend(rawURL string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	backend, exists := p.find(rawURL)
+	if !exists {
+		return ErrBackendNotFound
+	}
+
+	if p.isLastActive(rawURL) {
+		return ErrLastBackend
+	}
+
+	if !p.balancer.RemoveBackend(backend) {
+		return ErrBackendNotFound
+	}
+
+	delete(p.weights, rawURL)
+	p.draining.Delete(rawURL)
+	p.OutlierDetector.Forget(backend)
+	return nil
+}
+
+// SetDraining включает или выключает режим вывода бэкенда из работы:
+// бэкенд дообрабатывает текущие запросы, но новые на него не направляются
+func (p *Pool) SetDraining(rawURL string, draining bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.find(rawURL); !exists {
+		return ErrBackendNotFound
+	}
+
+	if draining {
+		if p.isLastActive(rawURL) {
+			return ErrLastBackend
+		}
+		p.draining.Store(rawURL, struct{}{})
+	} else {
+		p.draining.Delete(rawURL)
+	}
+	return nil
+}
+
+// isLastActive проверяет, что кроме rawURL в пуле не осталось бэкендов, не выводимых из работы.
+// Вызывается под блокировкой пула
+func (p *Pool) isLastActive(rawURL string) bool {
+	for _, other := range p.balancer.GetBackends() {
+		if _, draining := p.draining.Load(other.String()); !draining && other.String() != rawURL {
+			return false
+		}
+	}
+	return true
+}
+
+// Backends возвращает состояние всех бэкендов пула
+func (p *Pool) Backends() []entity.BackendStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	backends := p.balancer.GetBackends()
+	statuses := make([]entity.BackendStatus, 0, len(backends))
+	for _, backend := range backends {
+		_, draining := p.draining.Load(backend.String())
+		statuses = append(statuses, entity.BackendStatus{
+			Pool:         p.Name,
+			URL:          backend.String(),
+			Weight:       p.weights[backend.String()],
+			Healthy:      p.HealthChecker.IsAvailable(backend),
+			Ejected:      !p.OutlierDetector.IsAvailable(backend),
+			CircuitState: p.CircuitBreakers.State(backend),
+			Draining:     draining,
+			InFlight:     p.balancer.InFlight(backend),
+		})
+	}
+	return statuses
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestPool_AddRemoveDrainBackend(t *testing.T) {
+	a, _ := url.Parse("http://a")
+
+	pool, err := NewPool(PoolConfig{
+		Name:     DefaultPool,
+		Backends: []WeightedBackend{{URL: a, Weight: 1}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	if err := pool.AddBackend("http://b", 3); err != nil {
+		t.Fatalf("failed to add backend: %v", err)
+	}
+	if err := pool.AddBackend("http://b", 1); !errors.Is(err, ErrBackendExists) {
+		t.Errorf("Expected ErrBackendExists, got %v", err)
+	}
+
+	// на выводимый из работы бэкенд новые запросы не направляются
+	if err := pool.SetDraining("http://a", true); err != nil {
+		t.Fatalf("failed to drain backend: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if got := pool.Balancer.Next(); got.String() != "http://b" {
+			t.Errorf("Expected http://b, got %s", got)
+		}
+	}
+
+	statuses := pool.Backends()
+	if len(statuses) != 2 || !statuses[0].Draining || statuses[1].Weight != 3 {
+		t.Errorf("Unexpected backend statuses: %+v", statuses)
+	}
+
+	if err := pool.RemoveBackend("http://a"); err != nil {
+		t.Fatalf("failed to remove backend: %v", err)
+	}
+	if err := pool.RemoveBackend("http://a"); !errors.Is(err, ErrBackendNotFound) {
+		t.Errorf("Expected ErrBackendNotFound, got %v", err)
+	}
+
+	// последний активный бэкенд удалить нельзя
+	if err := pool.RemoveBackend("http://b"); !errors.Is(err, ErrLastBackend) {
+		t.Errorf("Expected ErrLastBackend, got %v", err)
+	}
+
+	// и вывести из работы тоже
+	if err := pool.SetDraining("http://b", true); !errors.Is(err, ErrLastBackend) {
+		t.Errorf("Expected ErrLastBackend, got %v", err)
+	}
+	if got := pool.Balancer.Next(); got.String() != "http://b" {
+		t.Errorf("Expected http://b, got %s", got)
+	}
+}
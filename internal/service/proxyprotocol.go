@@ -0,0 +1,291 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// сигнатура заголовка PROXY protocol v2
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// максимальная длина строки PROXY protocol v1 вместе с CRLF
+const proxyProtocolV1MaxLength = 107
+
+// ProxyProtocolConfig описывает прием заголовков PROXY protocol от балансировщика
+type ProxyProtocolConfig struct {
+	TrustedSources []string      // адреса и подсети балансировщиков, только от них принимается заголовок
+	HeaderTimeout  time.Duration // время на получение заголовка после установки соединения
+}
+
+// ProxyProtocolListener принимает соединения с заголовком PROXY protocol v1 или v2 и подменяет
+// адреса соединения адресами клиента. Заголовок читается в отдельной горутине,
+// чтобы медленное соединение не задерживало прием остальных
+type ProxyProtocolListener struct {
+	net.Listener
+	trusted []netip.Prefix
+	timeout time.Duration
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewProxyProtocolListener(inner net.Listener, config ProxyProtocolConfig) (*ProxyProtocolListener, error) {
+	trusted := make([]netip.Prefix, 0, len(config.TrustedSources))
+	for _, source := range config.TrustedSources {
+		prefix, err := parsePrefix(source)
+		if err != nil {
+			return nil, err
+		}
+		trusted = append(trusted, prefix)
+	}
+	if len(trusted) == 0 {
+		return nil, errors.New("proxy protocol requires trusted sources")
+	}
+
+	timeout := config.HeaderTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	l := &ProxyProtocolListener{
+		Listener: inner,
+		trusted:  trusted,
+		timeout:  timeout,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l, nil
+}
+
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *ProxyProtocolListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.Listener.Close()
+	})
+	return err
+}
+
+func (l *ProxyProtocolListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake читает заголовок от доверенного источника, соединения остальных передаются без изменений
+func (l *ProxyProtocolListener) handshake(conn net.Conn) {
+	if l.isTrusted(conn.RemoteAddr()) {
+		proxyConn, err := l.readHeader(conn)
+		if err != nil {
+			log.Printf("[PROXY PROTOCOL][%s] invalid header: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		conn = proxyConn
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *ProxyProtocolListener) isTrusted(addr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	for _, prefix := range l.trusted {
+		if prefix.Contains(addrPort.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *ProxyProtocolListener) readHeader(conn net.Conn) (*proxyProtocolConn, error) {
+	conn.SetReadDeadline(time.Now().Add(l.timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	proxyConn := &proxyProtocolConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+		remote: conn.RemoteAddr(),
+		local:  conn.LocalAddr(),
+	}
+
+	prefix, err := proxyConn.reader.Peek(len(proxyProtocolV2Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(prefix, proxyProtocolV2Signature):
+		err = proxyConn.readV2()
+	case bytes.HasPrefix(prefix, []byte("PROXY ")):
+		err = proxyConn.readV1()
+	default:
+		err = errors.New("missing header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return proxyConn, nil
+}
+
+// proxyProtocolConn отдает адреса из заголовка, данные после заголовка читаются из буфера
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+	local  net.Addr
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// readV1 разбирает текстовый заголовок вида "PROXY TCP4 src dst srcport dstport\r\n"
+func (c *proxyProtocolConn) readV1() error {
+	line, err := c.reader.ReadSlice('\n')
+	if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+		return err
+	}
+	if len(line) > proxyProtocolV1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return errors.New("v1 header too long or not terminated")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return errors.New("malformed v1 header")
+	}
+
+	// UNKNOWN - балансировщик не знает адреса клиента, остаются адреса соединения
+	if fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return fmt.Errorf("malformed v1 header %q", line)
+	}
+
+	src, err := parseV1Addr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return err
+	}
+	dst, err := parseV1Addr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return err
+	}
+	c.remote, c.local = src, dst
+	return nil
+}
+
+func parseV1Addr(ip, port string, ipv4 bool) (*net.TCPAddr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() != ipv4 {
+		return nil, fmt.Errorf("invalid v1 address %q", ip)
+	}
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 port %q", port)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(portNum))), nil
+}
+
+// readV2 разбирает двоичный заголовок, TLV-расширения пропускаются
+func (c *proxyProtocolConn) readV2() error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+
+	if header[12]>>4 != 2 {
+		return fmt.Errorf("unsupported v2 version %d", header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	family := header[13] >> 4
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL - проверка здоровья от самого балансировщика, адреса соединения не меняются
+		return nil
+	case 0x1:
+	default:
+		return fmt.Errorf("unsupported v2 command %d", command)
+	}
+
+	var size int
+	switch family {
+	case 0x1:
+		size = net.IPv4len
+	case 0x2:
+		size = net.IPv6len
+	default:
+		// UNSPEC и UNIX-сокеты не содержат IP клиента
+		return nil
+	}
+	if len(payload) < 2*size+4 {
+		return errors.New("v2 address block too short")
+	}
+
+	srcIP, _ := netip.AddrFromSlice(payload[:size])
+	dstIP, _ := netip.AddrFromSlice(payload[size : 2*size])
+	srcPort := binary.BigEndian.Uint16(payload[2*size:])
+	dstPort := binary.BigEndian.Uint16(payload[2*size+2:])
+
+	c.remote = net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP.Unmap(), srcPort))
+	c.local = net.TCPAddrFromAddrPort(netip.AddrPortFrom(dstIP.Unmap(), dstPort))
+	return nil
+}
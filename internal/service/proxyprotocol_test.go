@@ -0,0 +1,182 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProxyProtocolListener(t *testing.T, trusted ...string) *ProxyProtocolListener {
+	t.Helper()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := NewProxyProtocolListener(inner, ProxyProtocolConfig{TrustedSources: trusted, HeaderTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+// sendAndAccept отправляет данные в новое соединение и возвращает принятое listener соединение
+func sendAndAccept(t *testing.T, ln net.Listener, data []byte) net.Conn {
+	t.Helper()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	client.Write(data)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readAll(t *testing.T, conn net.Conn, n int) string {
+	t.Helper()
+
+	buf := make([]byte, n)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func TestProxyProtocolListener_V1(t *testing.T) {
+	ln := newTestProxyProtocolListener(t, "127.0.0.0/8")
+
+	conn := sendAndAccept(t, ln, []byte("PROXY TCP4 198.51.100.7 10.0.0.1 51234 8080\r\nhello"))
+
+	if got := conn.RemoteAddr().String(); got != "198.51.100.7:51234" {
+		t.Errorf("expected client address from header, got %s", got)
+	}
+	if got := conn.LocalAddr().String(); got != "10.0.0.1:8080" {
+		t.Errorf("expected destination address from header, got %s", got)
+	}
+	if got := readAll(t, conn, 5); got != "hello" {
+		t.Errorf("expected data after header, got %q", got)
+	}
+}
+
+func TestProxyProtocolListener_V2(t *testing.T) {
+	ln := newTestProxyProtocolListener(t, "127.0.0.1")
+
+	header := append([]byte{}, proxyProtocolV2Signature...)
+	header = append(header, 0x21, 0x21) // версия 2, PROXY, TCP через IPv6
+	header = binary.BigEndian.AppendUint16(header, 36+3)
+	header = append(header, net.ParseIP("2001:db8::17")...)
+	header = append(header, net.ParseIP("2001:db8::1")...)
+	header = binary.BigEndian.AppendUint16(header, 4711)
+	header = binary.BigEndian.AppendUint16(header, 443)
+	header = append(header, 0x04, 0x00, 0x00) // пустой TLV пропускается
+
+	conn := sendAndAccept(t, ln, append(header, "hello"...))
+
+	if got := conn.RemoteAddr().String(); got != "[2001:db8::17]:4711" {
+		t.Errorf("expected client address from header, got %s", got)
+	}
+	if got := readAll(t, conn, 5); got != "hello" {
+		t.Errorf("expected data after header, got %q", got)
+	}
+}
+
+func TestProxyProtocolListener_V2Local(t *testing.T) {
+	ln := newTestProxyProtocolListener(t, "127.0.0.1")
+
+	header := append([]byte{}, proxyProtocolV2Signature...)
+	header = append(header, 0x20, 0x00, 0x00, 0x00) // версия 2, LOCAL
+
+	conn := sendAndAccept(t, ln, append(header, "ok"...))
+
+	if got := conn.RemoteAddr().(*net.TCPAddr).IP.String(); got != "127.0.0.1" {
+		t.Errorf("expected connection address for LOCAL command, got %s", got)
+	}
+	if got := readAll(t, conn, 2); got != "ok" {
+		t.Errorf("expected data after header, got %q", got)
+	}
+}
+
+func TestProxyProtocolListener_UntrustedSource(t *testing.T) {
+	ln := newTestProxyProtocolListener(t, "10.0.0.0/8")
+
+	// заголовок от недоверенного источника не разбирается и остается в данных
+	data := "PROXY TCP4 198.51.100.7 10.0.0.1 51234 8080\r\n"
+	conn := sendAndAccept(t, ln, []byte(data))
+
+	if got := conn.RemoteAddr().(*net.TCPAddr).IP.String(); got != "127.0.0.1" {
+		t.Errorf("expected connection address, got %s", got)
+	}
+	if got := readAll(t, conn, len(data)); got != data {
+		t.Errorf("expected header to be passed through, got %q", got)
+	}
+}
+
+func TestProxyProtocolListener_InvalidHeader(t *testing.T) {
+	ln := newTestProxyProtocolListener(t, "127.0.0.0/8")
+
+	for _, data := range []string{
+		"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		"PROXY TCP4 198.51.100.7 10.0.0.1 51234\r\n",
+		"PROXY TCP6 198.51.100.7 10.0.0.1 51234 8080\r\n",
+	} {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Write([]byte(data))
+
+		// соединение закрывается прокси, не дойдя до Accept
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := client.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("%q: expected connection to be closed, got %v", data, err)
+		}
+		client.Close()
+	}
+}
+
+func TestProxyProtocolListener_ClientIP(t *testing.T) {
+	ln := newTestProxyProtocolListener(t, "127.0.0.0/8")
+
+	identifier := NewClientIdentifierService(true)
+	if err := identifier.SetClientIPConfig(ClientIPConfig{Source: ClientIPFromProxyProtocol}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(identifier.IdentifyClient(r)))
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Write([]byte("PROXY TCP4 198.51.100.7 10.0.0.1 51234 8080\r\n" +
+		"GET / HTTP/1.1\r\nHost: example.com\r\nX-Forwarded-For: 1.1.1.1\r\nConnection: close\r\n\r\n"))
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	resp, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ip:198.51.100.7"; !strings.Contains(string(resp), want) {
+		t.Errorf("expected client id %s in response, got %q", want, resp)
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Классы ошибок соединения, при которых запрос может быть повторен
+const (
+	RetryOnConnectRefused = "connect_refused"
+	RetryOnTimeout        = "timeout"
+	RetryOnReset          = "reset"
+)
+
+// RetryPolicyConfig содержит настройки повторных попыток
+type RetryPolicyConfig struct {
+	MaxAttempts int           // общее число попыток, 0 - по одной на каждый бэкенд
+	Methods     []string      // методы, которые можно повторять
+	StatusCodes []int         // коды ответа, при которых запрос повторяется
+	Errors      []string      // классы ошибок соединения, при которых запрос повторяется
+	BackoffBase time.Duration // задержка перед первым повтором
+	BackoffMax  time.Duration // верхняя граница задержки
+}
+
+// RetryPolicy решает, нужно ли повторять запрос, и считает задержку перед повтором
+type RetryPolicy struct {
+	maxAttempts int
+	methods     map[string]bool
+	statusCodes map[int]bool
+	errors      map[string]bool
+	backoffBase time.Duration
+	backoffMax  time.Duration
+}
+
+func NewRetryPolicy(config RetryPolicyConfig) *RetryPolicy {
+	// по умолчанию повторяются только идемпотентные методы
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodGet, http.MethodHead, http.MethodOptions,
+			http.MethodPut, http.MethodDelete, http.MethodTrace}
+	}
+	if len(config.StatusCodes) == 0 {
+		config.StatusCodes = []int{http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	if len(config.Errors) == 0 {
+		config.Errors = []string{RetryOnConnectRefused, RetryOnTimeout, RetryOnReset}
+	}
+	if config.BackoffMax < config.BackoffBase {
+		config.BackoffMax = config.BackoffBase
+	}
+
+	policy := &RetryPolicy{
+		maxAttempts: config.MaxAttempts,
+		methods:     make(map[string]bool, len(config.Methods)),
+		statusCodes: make(map[int]bool, len(config.StatusCodes)),
+		errors:      make(map[string]bool, len(config.Errors)),
+		backoffBase: config.BackoffBase,
+		backoffMax:  config.BackoffMax,
+	}
+	for _, method := range config.Methods {
+		policy.methods[strings.ToUpper(method)] = true
+	}
+	for _, code := range config.StatusCodes {
+		policy.statusCodes[code] = true
+	}
+	for _, class := range config.Errors {
+		policy.errors[class] = true
+	}
+
+	return policy
+}
+
+// MaxAttempts возвращает общее число попыток для пула из backends бэкендов
+func (p *RetryPolicy) MaxAttempts(backends int) int {
+	if p.maxAttempts > 0 {
+		return p.maxAttempts
+	}
+	return backends
+}
+
+// ShouldRetry решает, можно ли повторить запрос после ответа с кодом statusCode
+// или ошибки соединения err. Запрос, который не дошел до бэкенда (соединение отклонено
+// или выключатель разомкнут), повторяется для любого метода
+func (p *RetryPolicy) ShouldRetry(method string, statusCode int, err error) bool {
+	if statusCode > 0 {
+		return p.methods[method] && p.statusCodes[statusCode]
+	}
+
+	class := ClassifyError(err)
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return true
+	case class == RetryOnConnectRefused:
+		return p.errors[class]
+	case class == "":
+		return false
+	default:
+		return p.methods[method] && p.errors[class]
+	}
+}
+
+// Backoff возвращает задержку перед повтором с номером attempt (начиная с 1):
+// экспоненциальный рост с полным случайным разбросом
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	if p.backoffBase <= 0 || attempt <= 0 {
+		return 0
+	}
+
+	backoff := p.backoffBase << (attempt - 1)
+	if backoff > p.backoffMax || backoff <= 0 {
+		backoff = p.backoffMax
+	}
+	return time.Duration(rand.Int64N(int64(backoff) + 1))
+}
+
+// ClassifyError определяет класс ошибки соединения с бэкендом
+func ClassifyError(err error) string {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ""
+	}
+
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return RetryOnConnectRefused
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return RetryOnConnectRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return RetryOnReset
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return RetryOnTimeout
+	}
+	return ""
+}
+
+// RequestBodyConfig содержит ограничения на тело запроса и его буферизацию для повторов
+type RequestBodyConfig struct {
+	MaxSize          int64  // максимальный размер тела, 0 - без ограничения
+	ReplayBufferSize int64  // тело до этого размера хранится в памяти для повторов
+	SpillToDisk      bool   // большее тело сбрасывается во временный файл, иначе передается потоком без повторов
+	SpillDir         string // каталог временных файлов, по умолчанию системный
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	policy := NewRetryPolicy(RetryPolicyConfig{})
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	tests := []struct {
+		name       string
+		method     string
+		statusCode int
+		err        error
+		want       bool
+	}{
+		{"GET 503", http.MethodGet, http.StatusServiceUnavailable, nil, true},
+		{"GET 501", http.MethodGet, http.StatusNotImplemented, nil, false},
+		{"POST 503", http.MethodPost, http.StatusServiceUnavailable, nil, false},
+		{"POST connect refused", http.MethodPost, 0, refused, true},
+		{"POST reset", http.MethodPost, 0, reset, false},
+		{"GET reset", http.MethodGet, 0, reset, true},
+		{"POST circuit open", http.MethodPost, 0, ErrCircuitOpen, true},
+		{"GET unknown error", http.MethodGet, 0, errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.ShouldRetry(tt.method, tt.statusCode, tt.err); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := NewRetryPolicy(RetryPolicyConfig{
+		BackoffBase: 10 * time.Millisecond,
+		BackoffMax:  40 * time.Millisecond,
+	})
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		limit := min(10*time.Millisecond<<(attempt-1), 40*time.Millisecond)
+		if backoff := policy.Backoff(attempt); backoff < 0 || backoff > limit {
+			t.Errorf("attempt %d: backoff %v out of range [0, %v]", attempt, backoff, limit)
+		}
+	}
+
+	if got := policy.MaxAttempts(3); got != 3 {
+		t.Errorf("Expected 3 attempts by default, got %d", got)
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BabyJhon/cloudru-bootcamp/internal/entity"
+)
+
+// RetryBudgetConfig содержит настройки общего для всех запросов бюджета повторов
+type RetryBudgetConfig struct {
+	Enabled             bool
+	Ratio               float64       // доля повторов от числа запросов в окне (0..1)
+	MinRetriesPerSecond int           // повторы, разрешенные в секунду независимо от нагрузки
+	Window              time.Duration // окно, за которое считаются запросы и повторы
+}
+
+// budgetBucket хранит число запросов и повторов за одну секунду окна
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+// RetryBudget ограничивает долю повторных попыток среди всех запросов,
+// чтобы при деградации нескольких бэкендов повторы не умножали нагрузку
+type RetryBudget struct {
+	config    RetryBudgetConfig
+	buckets   []budgetBucket
+	exhausted atomic.Uint64 // число повторов, отклоненных из-за исчерпания бюджета
+	mu        sync.Mutex
+}
+
+func NewRetryBudget(config RetryBudgetConfig) *RetryBudget {
+	if config.Window < time.Second {
+		config.Window = 10 * time.Second
+	}
+	if config.Ratio <= 0 || config.Ratio > 1 {
+		config.Ratio = 0.2
+	}
+	if config.MinRetriesPerSecond < 0 {
+		config.MinRetriesPerSecond = 0
+	}
+
+	return &RetryBudget{
+		config:  config,
+		buckets: make([]budgetBucket, int(config.Window/time.Second)),
+	}
+}
+
+// RecordRequest учитывает новый входящий запрос
+func (b *RetryBudget) RecordRequest() {
+	if !b.config.Enabled {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bucket(time.Now()).requests++
+}
+
+// TryRetry резервирует повтор из бюджета, возвращает false, если бюджет исчерпан
+func (b *RetryBudget) TryRetry() bool {
+	if !b.config.Enabled {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	requests, retries := b.totals(now)
+	if float64(retries) >= b.allowed(requests) {
+		b.exhausted.Add(1)
+		return false
+	}
+
+	b.bucket(now).retries++
+	return true
+}
+
+// Stats возвращает текущее состояние бюджета
+func (b *RetryBudget) Stats() entity.RetryBudgetStats {
+	b.mu.Lock()
+	requests, retries := b.totals(time.Now())
+	b.mu.Unlock()
+
+	return entity.RetryBudgetStats{
+		Enabled:   b.config.Enabled,
+		Window:    b.config.Window.String(),
+		Requests:  requests,
+		Retries:   retries,
+		Available: max(int(b.allowed(requests))-retries, 0),
+		Exhausted: b.exhausted.Load(),
+	}
+}
+
+// allowed возвращает число повторов, допустимое в окне при requests запросах
+func (b *RetryBudget) allowed(requests int) float64 {
+	seconds := float64(len(b.buckets))
+	return b.config.Ratio*float64(requests) + float64(b.config.MinRetriesPerSecond)*seconds
+}
+
+func (b *RetryBudget) bucket(now time.Time) *budgetBucket {
+	second := now.Unix()
+	bucket := &b.buckets[second%int64(len(b.buckets))]
+	if bucket.second != second {
+		*bucket = budgetBucket{second: second}
+	}
+	return bucket
+}
+
+func (b *RetryBudget) totals(now time.Time) (requests, retries int) {
+	oldest := now.Unix() - int64(len(b.buckets))
+	for _, bucket := range b.buckets {
+		if bucket.second > oldest {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return requests, retries
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBudget_LimitsRetries(t *testing.T) {
+	budget := NewRetryBudget(RetryBudgetConfig{
+		Enabled:             true,
+		Ratio:               0.2,
+		MinRetriesPerSecond: 0,
+		Window:              10 * time.Second,
+	})
+
+	for i := 0; i < 10; i++ {
+		budget.RecordRequest()
+	}
+
+	// 20% от 10 запросов - 2 повтора
+	for i := 0; i < 2; i++ {
+		if !budget.TryRetry() {
+			t.Fatalf("Expected retry %d to be allowed", i+1)
+		}
+	}
+	if budget.TryRetry() {
+		t.Error("Expected retry to be rejected after budget is spent")
+	}
+
+	stats := budget.Stats()
+	if stats.Retries != 2 || stats.Available != 0 || stats.Exhausted != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestRetryBudget_Disabled(t *testing.T) {
+	budget := NewRetryBudget(RetryBudgetConfig{})
+
+	for i := 0; i < 100; i++ {
+		if !budget.TryRetry() {
+			t.Fatal("Expected disabled budget to allow all retries")
+		}
+	}
+}
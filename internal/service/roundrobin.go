@@ -7,6 +7,8 @@ import (
 )
 
 type RoundRobinBalancer struct {
+	filterChain
+	connTracker
 	backends []*url.URL
 	current  uint32
 	mutex    sync.RWMutex
@@ -19,8 +21,8 @@ func NewRoundRobinBalancer(backends []*url.URL) *RoundRobinBalancer {
 	}
 }
 
-// добавляет бэкенд в балансировщик потокобезопасным способом
-func (b *RoundRobinBalancer) AddBackend(backend *url.URL) {
+// добавляет бэкенд в балансировщик потокобезопасным способом, вес не учитывается
+func (b *RoundRobinBalancer) AddBackend(backend *url.URL, weight int) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
@@ -43,15 +45,31 @@ func (b *RoundRobinBalancer) RemoveBackend(backend *url.URL) bool {
 func (b *RoundRobinBalancer) Next() *url.URL {
 	next := atomic.AddUint32(&b.current, 1)
 
-	// захватываем блокировку на чтение для доступа к списку бэкендов
-	b.mutex.RLock()
-	defer b.mutex.RUnlock()
-
-	if len(b.backends) == 0 {
+	// фильтры вызываются по копии списка без блокировки балансировщика,
+	// иначе возможна взаимоблокировка с фильтрами, читающими GetBackends
+	backends := b.GetBackends()
+	if len(backends) == 0 {
 		return nil
 	}
 
-	return b.backends[(next-1)%uint32(len(b.backends))]
+	// пропускаем недоступные бэкенды, сохраняя порядок обхода
+	count := uint32(len(backends))
+	for i := uint32(0); i < count; i++ {
+		backend := backends[(next-1+i)%count]
+		if b.isSelectable(backend) {
+			return backend
+		}
+	}
+
+	// если недоступны все бэкенды, лучше попробовать хоть какой-то, чем сразу отказать,
+	// но выводимые из работы бэкенды не выбираются никогда
+	for i := uint32(0); i < count; i++ {
+		backend := backends[(next-1+i)%count]
+		if b.isAllowed(backend) {
+			return backend
+		}
+	}
+	return nil
 }
 
 func (b *RoundRobinBalancer) GetBackends() []*url.URL {
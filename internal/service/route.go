@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Route описывает правило направления запросов в пул бэкендов.
+// Пустые условия не проверяются, заданные условия должны выполняться все сразу
+type Route struct {
+	Name       string
+	Host       string
+	PathPrefix string
+	PathRegex  *regexp.Regexp
+	Methods    []string
+	Headers    map[string]string
+	Pool       *Pool
+	Hedge      *HedgePolicy // nil, если дублирование запросов выключено
+	Streaming  StreamingConfig
+}
+
+// RouteConfig содержит настройки маршрута из конфигурации
+type RouteConfig struct {
+	Name       string
+	Host       string
+	PathPrefix string
+	PathRegex  string
+	Methods    []string
+	Headers    map[string]string
+	Pool       string
+	Hedge      HedgeConfig
+	Streaming  StreamingConfig
+}
+
+// StreamingConfig содержит настройки маршрута с потоковыми ответами (SSE, long-poll)
+type StreamingConfig struct {
+	Enabled       bool
+	FlushInterval time.Duration // как часто сбрасывать ответ клиенту, 0 - сразу после каждой записи
+	MaxDuration   time.Duration // ограничение длительности запроса вместо таймаута пула, 0 - без ограничения
+	HeaderTimeout time.Duration // ожидание заголовков ответа бэкенда, 0 - без ограничения
+}
+
+func NewRoute(config RouteConfig, pools map[string]*Pool) (*Route, error) {
+	pool, ok := pools[config.Pool]
+	if !ok {
+		return nil, fmt.Errorf("route %q refers to unknown pool %q", config.Name, config.Pool)
+	}
+
+	route := &Route{
+		Name:       config.Name,
+		Host:       config.Host,
+		PathPrefix: config.PathPrefix,
+		Methods:    config.Methods,
+		Headers:    config.Headers,
+		Pool:       pool,
+		Hedge:      NewHedgePolicy(config.Hedge),
+		Streaming:  config.Streaming,
+	}
+
+	if config.PathRegex != "" {
+		re, err := regexp.Compile(config.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: invalid path regex: %w", config.Name, err)
+		}
+		route.PathRegex = re
+	}
+
+	return route, nil
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"log"
 	"net/http"
 	"net/url"
 	"time"
@@ -12,6 +13,31 @@ import (
 type Balancer interface {
 	Next() *url.URL
 	GetBackends() []*url.URL
+	// прокси сообщает о начале и завершении каждого запроса к выбранному бэкенду
+	RequestStarted(backend *url.URL)
+	RequestFinished(backend *url.URL)
+}
+
+// Интерфейс для балансировщиков, учитывающих время ответа бэкендов
+type LatencyObserver interface {
+	ObserveLatency(backend *url.URL, duration time.Duration)
+	ObserveFailure(backend *url.URL, duration time.Duration)
+}
+
+// Интерфейс для балансировщиков, закрепляющих ключ запроса (ID клиента) за бэкендом
+type KeyedBalancer interface {
+	NextForKey(key string) *url.URL
+}
+
+// Интерфейс для исключения недоступных бэкендов из балансировки
+type BackendFilter interface {
+	IsAvailable(backend *url.URL) bool
+}
+
+// Интерфейс для сбора статистики ответов бэкендов
+type BackendObserver interface {
+	ReportSuccess(backend *url.URL)
+	ReportFailure(backend *url.URL)
 }
 
 type ClientIdentifier interface {
@@ -26,13 +52,20 @@ type RateLimiterService interface {
 }
 
 type Service struct {
-	Balancer         Balancer
+	Pools            []*Pool
+	Routes           []*Route
 	ClientIdentifier ClientIdentifier
 	RateLimiter      RateLimiterService
 	ClientService    *ClientService
+	BackendService   *BackendService
+	StickySessions   *StickySessions
+	RetryBudget      *RetryBudget
+	RequestBody      RequestBodyConfig
+	UpgradeTracker   *UpgradeTracker
+	Certificates     *CertificateStore // nil, если TLS-порт выключен
 }
 
-func NewService(backends []*url.URL) *Service {
+func NewService(backends []configs.Backend) *Service {
 	cfg := configs.Load()
 
 	config := RateLimiterConfig{
@@ -46,6 +79,15 @@ func NewService(backends []*url.URL) *Service {
 	clientService := NewClientService(rateLimiter)
 
 	clientIdentifier := NewClientIdentifierService(true)
+	err := clientIdentifier.SetClientIPConfig(ClientIPConfig{
+		TrustedProxies: cfg.ClientIP.TrustedProxies,
+		Source:         cfg.ClientIP.Source,
+		Header:         cfg.ClientIP.TrustedHeader,
+		LegacyHeaders:  cfg.ClientIP.LegacyHeaders,
+	})
+	if err != nil {
+		log.Fatal("failed to configure client ip: ", err)
+	}
 
 	for _, client := range cfg.RateLimiter.SpecialClients {
 		rateLimiter.UpdateClient(client.ID, client.Capacity, client.RefillRate)
@@ -53,10 +95,240 @@ func NewService(backends []*url.URL) *Service {
 
 	rateLimiter.SetIPBasedConfig(cfg.RateLimiter.IPBased.Capacity, cfg.RateLimiter.IPBased.RefillRate)
 
+	// бэкенды верхнего уровня образуют пул по умолчанию
+	poolConfigs := []configs.PoolConfig{{
+		Name:     DefaultPool,
+		Balancer: cfg.Balancer,
+		Timeout:  cfg.Timeout,
+		Protocol: cfg.Protocol,
+		TLS:      cfg.UpstreamTLS,
+		Retry:    cfg.Retry,
+		Mirror:   cfg.Mirror,
+		Canary:   cfg.Canary,
+	}}
+	poolConfigs = append(poolConfigs, cfg.Pools...)
+
+	pools := make([]*Pool, 0, len(poolConfigs))
+	poolsByName := make(map[string]*Pool, len(poolConfigs))
+	for i, poolCfg := range poolConfigs {
+		poolBackends := backends
+		if i > 0 {
+			var err error
+			poolBackends, err = configs.NewBackends("", poolCfg.Backends).GetBackends()
+			if err != nil || len(poolCfg.Backends) == 0 {
+				log.Fatalf("failed to load backends of pool %q: %v", poolCfg.Name, err)
+			}
+		}
+
+		if _, exists := poolsByName[poolCfg.Name]; exists {
+			log.Fatalf("duplicate pool name %q", poolCfg.Name)
+		}
+
+		pool, err := NewPool(newPoolConfig(cfg, poolCfg, poolBackends))
+		if err != nil {
+			log.Fatal("failed to create pool: ", err)
+		}
+		pools = append(pools, pool)
+		poolsByName[pool.Name] = pool
+	}
+
+	// теневые и канареечные пулы связываются после создания всех пулов
+	for i, poolCfg := range poolConfigs {
+		if canaryPool := poolCfg.Canary.Pool; canaryPool != "" {
+			if target, ok := poolsByName[canaryPool]; !ok || target == pools[i] {
+				log.Fatalf("pool %q has invalid canary pool %q", poolCfg.Name, canaryPool)
+			}
+		}
+
+		if poolCfg.Mirror.Pool == "" {
+			continue
+		}
+		shadow, ok := poolsByName[poolCfg.Mirror.Pool]
+		if !ok || shadow == pools[i] {
+			log.Fatalf("pool %q has invalid mirror pool %q", poolCfg.Name, poolCfg.Mirror.Pool)
+		}
+		pools[i].Mirror = NewMirror(MirrorConfig{
+			Pool:    poolCfg.Mirror.Pool,
+			Percent: poolCfg.Mirror.Percent,
+			Timeout: poolCfg.Mirror.Timeout,
+		}, shadow)
+	}
+
+	routes := make([]*Route, 0, len(cfg.Routes))
+	for _, routeCfg := range cfg.Routes {
+		route, err := NewRoute(RouteConfig{
+			Name:       routeCfg.Name,
+			Host:       routeCfg.Host,
+			PathPrefix: routeCfg.PathPrefix,
+			PathRegex:  routeCfg.PathRegex,
+			Methods:    routeCfg.Methods,
+			Headers:    routeCfg.Headers,
+			Pool:       routeCfg.Pool,
+			Hedge: HedgeConfig{
+				Enabled:    routeCfg.Hedge.Enabled,
+				Percentile: routeCfg.Hedge.Percentile,
+				Delay:      routeCfg.Hedge.Delay,
+				MinDelay:   routeCfg.Hedge.MinDelay,
+				MaxDelay:   routeCfg.Hedge.MaxDelay,
+			},
+			Streaming: StreamingConfig{
+				Enabled:       routeCfg.Streaming.Enabled,
+				FlushInterval: routeCfg.Streaming.FlushInterval,
+				MaxDuration:   routeCfg.Streaming.MaxDuration,
+				HeaderTimeout: routeCfg.Streaming.HeaderTimeout,
+			},
+		}, poolsByName)
+		if err != nil {
+			log.Fatal("failed to create route: ", err)
+		}
+		routes = append(routes, route)
+	}
+
+	stickySessions := NewStickySessions(StickySessionConfig{
+		Enabled:    cfg.StickySession.Enabled,
+		CookieName: cfg.StickySession.CookieName,
+		TTL:        cfg.StickySession.TTL,
+		Secret:     cfg.StickySession.Secret,
+	})
+
+	retryBudget := NewRetryBudget(RetryBudgetConfig{
+		Enabled:             cfg.RetryBudget.Enabled,
+		Ratio:               cfg.RetryBudget.Ratio,
+		MinRetriesPerSecond: cfg.RetryBudget.MinRetriesPerSecond,
+		Window:              cfg.RetryBudget.Window,
+	})
+
+	upgradeTracker := NewUpgradeTracker(UpgradeConfig{
+		IdleTimeout:  cfg.Upgrade.IdleTimeout,
+		MaxLifetime:  cfg.Upgrade.MaxLifetime,
+		MaxPerClient: cfg.Upgrade.MaxPerClient,
+	})
+
+	requestBody := RequestBodyConfig{
+		MaxSize:          cfg.RequestBody.MaxSize,
+		ReplayBufferSize: cfg.RequestBody.ReplayBufferSize,
+		SpillToDisk:      cfg.RequestBody.SpillToDisk,
+		SpillDir:         cfg.RequestBody.SpillDir,
+	}
+
+	var identifier ClientIdentifier = clientIdentifier
+	var certificates *CertificateStore
+	if cfg.Listener.TLS.Enabled {
+		pairs := make([]CertificatePair, len(cfg.Listener.TLS.Certificates))
+		for i, certificate := range cfg.Listener.TLS.Certificates {
+			pairs[i] = CertificatePair{CertFile: certificate.CertFile, KeyFile: certificate.KeyFile}
+		}
+
+		var err error
+		certificates, err = NewCertificateStore(pairs)
+		if err != nil {
+			log.Fatal("failed to load tls certificates: ", err)
+		}
+
+		// при проверке клиентских сертификатов клиент определяется по сертификату
+		if mode := cfg.Listener.TLS.ClientAuth.Mode; mode != "" && mode != "none" {
+			identifier, err = NewCertificateIdentifierService(clientIdentifier, cfg.Listener.TLS.ClientAuth.Identity)
+			if err != nil {
+				log.Fatal("failed to create client identifier: ", err)
+			}
+		}
+	}
+
 	return &Service{
-		Balancer:         NewRoundRobinBalancer(backends),
+		Pools:            pools,
+		Routes:           routes,
+		StickySessions:   stickySessions,
+		RetryBudget:      retryBudget,
+		RequestBody:      requestBody,
+		UpgradeTracker:   upgradeTracker,
+		Certificates:     certificates,
 		RateLimiter:      rateLimiter,
 		ClientService:    clientService,
-		ClientIdentifier: clientIdentifier,
+		BackendService:   NewBackendService(pools),
+		ClientIdentifier: identifier,
+	}
+}
+
+// Pool возвращает пул по имени
+func (s *Service) Pool(name string) (*Pool, bool) {
+	for _, pool := range s.Pools {
+		if pool.Name == name {
+			return pool, true
+		}
+	}
+	return nil, false
+}
+
+// newPoolConfig переводит настройки пула из конфигурации в настройки сервиса.
+// Проверки бэкендов у всех пулов общие и задаются на верхнем уровне конфигурации
+func newPoolConfig(cfg *configs.Config, poolCfg configs.PoolConfig, backends []configs.Backend) PoolConfig {
+	weighted := make([]WeightedBackend, len(backends))
+	for i, backend := range backends {
+		weighted[i] = WeightedBackend{URL: backend.URL, Weight: backend.Weight}
+	}
+
+	return PoolConfig{
+		Name:     poolCfg.Name,
+		Backends: weighted,
+		Balancer: BalancerConfig{
+			Strategy:     poolCfg.Balancer.Strategy,
+			EWMAAlpha:    poolCfg.Balancer.EWMAAlpha,
+			VirtualNodes: poolCfg.Balancer.VirtualNodes,
+		},
+		Timeout:  poolCfg.Timeout,
+		Protocol: poolCfg.Protocol,
+		TLS: UpstreamTLSConfig{
+			CAFile:             poolCfg.TLS.CAFile,
+			CertFile:           poolCfg.TLS.CertFile,
+			KeyFile:            poolCfg.TLS.KeyFile,
+			ServerName:         poolCfg.TLS.ServerName,
+			InsecureSkipVerify: poolCfg.TLS.InsecureSkipVerify,
+		},
+		Retry: RetryPolicyConfig{
+			MaxAttempts: poolCfg.Retry.MaxAttempts,
+			Methods:     poolCfg.Retry.Methods,
+			StatusCodes: poolCfg.Retry.StatusCodes,
+			Errors:      poolCfg.Retry.Errors,
+			BackoffBase: poolCfg.Retry.BackoffBase,
+			BackoffMax:  poolCfg.Retry.BackoffMax,
+		},
+		Canary: CanaryConfig{
+			Pool:        poolCfg.Canary.Pool,
+			Percent:     poolCfg.Canary.Percent,
+			Header:      poolCfg.Canary.Header,
+			HeaderValue: poolCfg.Canary.HeaderValue,
+			Cookie:      poolCfg.Canary.Cookie,
+			CookieValue: poolCfg.Canary.CookieValue,
+			Consistent:  poolCfg.Canary.Consistent,
+		},
+		HealthCheck: HealthCheckConfig{
+			Enabled:            cfg.HealthCheck.Enabled,
+			Path:               cfg.HealthCheck.Path,
+			Interval:           cfg.HealthCheck.Interval,
+			Timeout:            cfg.HealthCheck.Timeout,
+			HealthyThreshold:   cfg.HealthCheck.HealthyThreshold,
+			UnhealthyThreshold: cfg.HealthCheck.UnhealthyThreshold,
+		},
+		OutlierDetection: OutlierDetectionConfig{
+			Enabled:            cfg.OutlierDetection.Enabled,
+			ConsecutiveErrors:  cfg.OutlierDetection.ConsecutiveErrors,
+			BaseEjectionTime:   cfg.OutlierDetection.BaseEjectionTime,
+			MaxEjectionTime:    cfg.OutlierDetection.MaxEjectionTime,
+			MaxEjectionPercent: cfg.OutlierDetection.MaxEjectionPercent,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Enabled:          cfg.CircuitBreaker.Enabled,
+			Window:           cfg.CircuitBreaker.Window,
+			ErrorThreshold:   cfg.CircuitBreaker.ErrorThreshold,
+			MinRequests:      cfg.CircuitBreaker.MinRequests,
+			OpenDuration:     cfg.CircuitBreaker.OpenDuration,
+			HalfOpenRequests: cfg.CircuitBreaker.HalfOpenRequests,
+		},
+		SlowStart: SlowStartConfig{
+			Enabled:          cfg.SlowStart.Enabled,
+			Window:           cfg.SlowStart.Window,
+			MinWeightPercent: cfg.SlowStart.MinWeightPercent,
+			Aggression:       cfg.SlowStart.Aggression,
+		},
 	}
 }
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// SlowStartConfig содержит настройки плавного ввода бэкенда в работу
+type SlowStartConfig struct {
+	Enabled          bool
+	Window           time.Duration // за это время доля трафика растет до полной
+	MinWeightPercent int           // доля трафика в начале окна
+	Aggression       float64       // 1 - линейный рост, больше 1 - быстрее в начале окна
+}
+
+// Интерфейс для получения уведомлений о возвращении бэкенда в балансировку
+type RecoveryListener interface {
+	BackendRecovered(backend *url.URL, at time.Time)
+}
+
+// SlowStart плавно увеличивает долю трафика на добавленный или восстановившийся бэкенд.
+// Для взвешенных стратегий масштабируется вес бэкенда, для остальных при выборе без ключа бэкенд
+// пропускается фильтром с вероятностью, равной текущей доле
+type SlowStart struct {
+	config  SlowStartConfig
+	started map[string]time.Time
+	mu      sync.Mutex
+}
+
+func NewSlowStart(config SlowStartConfig) *SlowStart {
+	if config.Window <= 0 {
+		config.Window = 30 * time.Second
+	}
+	if config.MinWeightPercent <= 0 || config.MinWeightPercent > 100 {
+		config.MinWeightPercent = 10
+	}
+	if config.Aggression <= 0 {
+		config.Aggression = 1
+	}
+
+	return &SlowStart{
+		config:  config,
+		started: make(map[string]time.Time),
+	}
+}
+
+// BackendRecovered начинает окно плавного ввода бэкенда с момента at
+func (s *SlowStart) BackendRecovered(backend *url.URL, at time.Time) {
+	if !s.config.Enabled {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.started[backend.String()] = at
+}
+
+// Factor возвращает долю от полного веса бэкенда (от min_weight_percent до 1)
+func (s *SlowStart) Factor(backend *url.URL) float64 {
+	if !s.config.Enabled {
+		return 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := backend.String()
+	started, ok := s.started[key]
+	if !ok {
+		return 1
+	}
+
+	elapsed := time.Since(started)
+	if elapsed >= s.config.Window {
+		delete(s.started, key)
+		return 1
+	}
+
+	minFactor := float64(s.config.MinWeightPercent) / 100
+	if elapsed <= 0 {
+		return minFactor
+	}
+
+	progress := float64(elapsed) / float64(s.config.Window)
+	return math.Max(minFactor, math.Pow(progress, 1/s.config.Aggression))
+}
+
+// IsAvailable пропускает бэкенд в окне плавного ввода с вероятностью Factor
+func (s *SlowStart) IsAvailable(backend *url.URL) bool {
+	factor := s.Factor(backend)
+	return factor >= 1 || rand.Float64() < factor
+}
+
+// recoveryNotifier рассылает уведомления о возвращении бэкенда в балансировку.
+// Слушатели добавляются при создании пула, до начала обработки запросов
+type recoveryNotifier struct {
+	listeners []RecoveryListener
+}
+
+func (n *recoveryNotifier) AddRecoveryListener(listener RecoveryListener) {
+	n.listeners = append(n.listeners, listener)
+}
+
+func (n *recoveryNotifier) notifyRecovered(backend *url.URL, at time.Time) {
+	for _, listener := range n.listeners {
+		listener.BackendRecovered(backend, at)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSlowStart_FactorRamp(t *testing.T) {
+	backend, _ := url.Parse("http://a")
+	slowStart := NewSlowStart(SlowStartConfig{
+		Enabled:          true,
+		Window:           time.Minute,
+		MinWeightPercent: 10,
+		Aggression:       1,
+	})
+
+	if factor := slowStart.Factor(backend); factor != 1 {
+		t.Errorf("Expected full weight for backend outside slow start, got %v", factor)
+	}
+
+	slowStart.BackendRecovered(backend, time.Now())
+	if factor := slowStart.Factor(backend); factor > 0.11 {
+		t.Errorf("Expected minimal weight at window start, got %v", factor)
+	}
+
+	slowStart.BackendRecovered(backend, time.Now().Add(-30*time.Second))
+	if factor := slowStart.Factor(backend); factor < 0.49 || factor > 0.51 {
+		t.Errorf("Expected half weight in the middle of window, got %v", factor)
+	}
+
+	slowStart.BackendRecovered(backend, time.Now().Add(-time.Minute))
+	if factor := slowStart.Factor(backend); factor != 1 {
+		t.Errorf("Expected full weight after window, got %v", factor)
+	}
+}
+
+func TestSlowStart_KeyedLookupsStayPinned(t *testing.T) {
+	a, _ := url.Parse("http://a")
+	b, _ := url.Parse("http://b")
+
+	pool, err := NewPool(PoolConfig{
+		Name:      DefaultPool,
+		Backends:  []WeightedBackend{{URL: a, Weight: 1}, {URL: b, Weight: 1}},
+		Balancer:  BalancerConfig{Strategy: StrategyConsistentHash},
+		SlowStart: SlowStartConfig{Enabled: true, Window: time.Minute, MinWeightPercent: 1},
+	})
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	keyed := pool.Balancer.(KeyedBalancer)
+
+	before := make(map[string]*url.URL)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		before[key] = keyed.NextForKey(key)
+	}
+
+	// бэкенд в начале окна плавного ввода, но закрепленные за ним ключи не переназначаются
+	pool.SlowStart.BackendRecovered(before["client-0"], time.Now())
+	for key, backend := range before {
+		if got := keyed.NextForKey(key); got != backend {
+			t.Errorf("Expected key %s to stay on %s, got %s", key, backend, got)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StickySessionConfig содержит настройки закрепления клиента за бэкендом через cookie
+type StickySessionConfig struct {
+	Enabled    bool
+	CookieName string
+	TTL        time.Duration
+	Secret     string
+}
+
+// StickySessions формирует и проверяет cookie привязки к бэкенду.
+// Значение cookie не раскрывает адрес бэкенда: оно содержит срок действия
+// и HMAC от пула, адреса бэкенда и срока, поэтому подделать его без секрета нельзя.
+// У каждого пула своя cookie, чтобы привязка не терялась при переходе клиента между маршрутами
+type StickySessions struct {
+	config StickySessionConfig
+}
+
+func NewStickySessions(config StickySessionConfig) *StickySessions {
+	if config.CookieName == "" {
+		config.CookieName = "proxy_affinity"
+	}
+	if config.TTL <= 0 {
+		config.TTL = time.Hour
+	}
+
+	return &StickySessions{config: config}
+}
+
+func (s *StickySessions) Enabled() bool {
+	return s.config.Enabled
+}
+
+// CookieName возвращает имя cookie привязки для пула
+func (s *StickySessions) CookieName(pool string) string {
+	return s.config.CookieName + "_" + pool
+}
+
+func (s *StickySessions) TTL() time.Duration {
+	return s.config.TTL
+}
+
+func (s *StickySessions) sign(pool string, backend *url.URL, expires string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Secret))
+	mac.Write([]byte(pool + "|" + backend.String() + "|" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Encode возвращает значение cookie для бэкенда пула
+func (s *StickySessions) Encode(pool string, backend *url.URL) string {
+	expires := strconv.FormatInt(time.Now().Add(s.config.TTL).Unix(), 10)
+	return expires + "." + s.sign(pool, backend, expires)
+}
+
+// Decode находит среди бэкендов пула тот, на который указывает cookie.
+// Возвращает false, если cookie просрочена, подделана, выдана другим пулом или бэкенда больше нет
+func (s *StickySessions) Decode(pool, value string, backends []*url.URL) (*url.URL, bool) {
+	expires, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, false
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return nil, false
+	}
+
+	for _, backend := range backends {
+		if hmac.Equal([]byte(s.sign(pool, backend, expires)), []byte(signature)) {
+			return backend, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// NewUpstreamTransport создает транспорт к бэкендам пула. Им пользуются и прокси, и проверка здоровья,
+// чтобы бэкенды опрашивались по тому же протоколу, по которому получают запросы
+func NewUpstreamTransport(protocol string, tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       30 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		Protocols:       UpstreamProtocols(protocol),
+		TLSClientConfig: tlsConfig,
+	}
+}
+
+// UpstreamProtocols возвращает протоколы транспорта для протокола пула
+func UpstreamProtocols(protocol string) *http.Protocols {
+	protocols := new(http.Protocols)
+	switch protocol {
+	case ProtocolHTTP2:
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	case ProtocolH2C:
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		protocols.SetHTTP1(true)
+	}
+	return protocols
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrTooManyUpgrades = errors.New("too many upgraded connections")
+
+// UpgradeConfig содержит ограничения для соединений, переключенных на другой протокол (WebSocket)
+type UpgradeConfig struct {
+	IdleTimeout  time.Duration // соединение закрывается после такого простоя, 0 - без ограничения
+	MaxLifetime  time.Duration // максимальная длительность соединения, 0 - без ограничения
+	MaxPerClient int           // одновременных соединений на клиента, 0 - без ограничения
+}
+
+// UpgradeTracker учитывает открытые соединения всех пулов и ограничивает их число на клиента
+type UpgradeTracker struct {
+	config  UpgradeConfig
+	clients map[string]int
+	active  atomic.Int64
+	mu      sync.Mutex
+}
+
+func NewUpgradeTracker(config UpgradeConfig) *UpgradeTracker {
+	return &UpgradeTracker{
+		config:  config,
+		clients: make(map[string]int),
+	}
+}
+
+func (t *UpgradeTracker) Config() UpgradeConfig {
+	return t.config
+}
+
+// Acquire учитывает новое соединение клиента, если лимит клиента не исчерпан
+func (t *UpgradeTracker) Acquire(clientID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.config.MaxPerClient > 0 && t.clients[clientID] >= t.config.MaxPerClient {
+		return ErrTooManyUpgrades
+	}
+	t.clients[clientID]++
+	t.active.Add(1)
+	return nil
+}
+
+// Release освобождает соединение клиента
+func (t *UpgradeTracker) Release(clientID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.clients[clientID] <= 1 {
+		delete(t.clients, clientID)
+	} else {
+		t.clients[clientID]--
+	}
+	t.active.Add(-1)
+}
+
+// Active возвращает число открытых соединений
+func (t *UpgradeTracker) Active() int64 {
+	return t.active.Load()
+}
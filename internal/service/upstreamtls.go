@@ -0,0 +1,65 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// UpstreamTLSConfig содержит настройки TLS-соединений прокси с бэкендами пула
+type UpstreamTLSConfig struct {
+	CAFile             string // сертификаты удостоверяющих центров бэкендов, пусто - системные
+	CertFile           string // клиентский сертификат для mTLS
+	KeyFile            string
+	ServerName         string // имя сервера для SNI и проверки сертификата вместо хоста бэкенда
+	InsecureSkipVerify bool   // не проверять сертификат бэкенда, только для локального тестирования
+}
+
+// NewUpstreamTLS собирает TLS-настройки клиента. Возвращает nil, если ничего не задано
+func NewUpstreamTLS(config UpstreamTLSConfig) (*tls.Config, error) {
+	if config == (UpstreamTLSConfig{}) {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.CAFile != "" {
+		pool, err := LoadCertPool(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("client certificate requires both cert_file and key_file")
+	}
+	if config.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// LoadCertPool читает сертификаты удостоверяющих центров из PEM-файла
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ca file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
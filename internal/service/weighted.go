@@ -0,0 +1,131 @@
+package service
+
+import (
+	"net/url"
+	"sync"
+)
+
+type weightedBackend struct {
+	url           *url.URL
+	weight        int
+	currentWeight float64
+}
+
+// WeightedRoundRobinBalancer реализует плавный взвешенный round-robin (как в nginx):
+// бэкенды выбираются пропорционально весам, но без серий подряд к одному бэкенду
+type WeightedRoundRobinBalancer struct {
+	filterChain
+	connTracker
+	backends []*weightedBackend
+	scale    func(backend *url.URL) float64
+	mutex    sync.Mutex
+}
+
+func NewWeightedRoundRobinBalancer(backends []WeightedBackend) *WeightedRoundRobinBalancer {
+	b := &WeightedRoundRobinBalancer{}
+	for _, backend := range backends {
+		b.AddBackend(backend.URL, backend.Weight)
+	}
+	return b
+}
+
+// SetWeightScale задает множитель веса бэкенда, например для плавного ввода в работу
+func (b *WeightedRoundRobinBalancer) SetWeightScale(scale func(backend *url.URL) float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.scale = scale
+}
+
+func (b *WeightedRoundRobinBalancer) AddBackend(backend *url.URL, weight int) {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.backends = append(b.backends, &weightedBackend{url: backend, weight: weight})
+}
+
+func (b *WeightedRoundRobinBalancer) RemoveBackend(backend *url.URL) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for i, wb := range b.backends {
+		if wb.url.String() == backend.String() {
+			b.backends = append(b.backends[:i], b.backends[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (b *WeightedRoundRobinBalancer) Next() *url.URL {
+	b.mutex.Lock()
+	backends := make([]*weightedBackend, len(b.backends))
+	copy(backends, b.backends)
+	scale := b.scale
+	b.mutex.Unlock()
+
+	// фильтры и множители весов берут собственные блокировки, поэтому вызываются
+	// без блокировки балансировщика: детектор выбросов под своей блокировкой читает GetBackends
+	weights := make([]float64, len(backends))
+	available := make([]bool, len(backends))
+	allowed := make([]bool, len(backends))
+	anyAvailable := false
+	for i, wb := range backends {
+		weights[i] = float64(wb.weight)
+		if scale != nil {
+			weights[i] *= scale(wb.url)
+		}
+		available[i] = b.IsAvailable(wb.url)
+		allowed[i] = b.isAllowed(wb.url)
+		anyAvailable = anyAvailable || available[i]
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// если недоступны все бэкенды, выбираем среди всех, кроме выводимых из работы
+	if best := b.pick(backends, weights, func(i int) bool { return available[i] || (!anyAvailable && allowed[i]) }); best != nil {
+		return best.url
+	}
+	return nil
+}
+
+// pick выбирает бэкенд плавным взвешенным round-robin среди тех, что пропускает include.
+// Вызывается под блокировкой балансировщика
+func (b *WeightedRoundRobinBalancer) pick(backends []*weightedBackend, weights []float64, include func(i int) bool) *weightedBackend {
+	var best *weightedBackend
+	total := 0.0
+
+	for i, wb := range backends {
+		if !include(i) {
+			continue
+		}
+
+		weight := weights[i]
+		wb.currentWeight += weight
+		total += weight
+		if best == nil || wb.currentWeight > best.currentWeight {
+			best = wb
+		}
+	}
+
+	if best != nil {
+		best.currentWeight -= total
+	}
+	return best
+}
+
+func (b *WeightedRoundRobinBalancer) GetBackends() []*url.URL {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	result := make([]*url.URL, len(b.backends))
+	for i, wb := range b.backends {
+		result[i] = wb.url
+	}
+	return result
+}